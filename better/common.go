@@ -2,34 +2,43 @@ package better
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"sort"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/hashicorp/aws-sdk-go-base/tfawserr"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
-type Password struct {
-	AdminPassword        string `json:"ADMIN_PASSWORD,omitempty"`
-	AuthToken            string `json:"AUTH_TOKEN,omitempty"`
-	ReadOnlyUserPassword string `json:"READONLY_USER_PASSWORD,omitempty"`
-	UserPassword         string `json:"USER_PASSWORD,omitempty"`
-}
+const (
+	OnDestroyRetain               = "retain"
+	OnDestroyScramble             = "scramble"
+	OnDestroyClearSecret          = "clear_secret"
+	OnDestroyRemoveSdmCredentials = "remove_sdm_credentials"
+
+	secretUpdateAttempts = 3
+
+	// secretStagePending labels a version written by the provider until it is made current
+	secretStagePending = "BETTERPENDING"
+)
+
+// Password holds the secret keys and their values.
+type Password map[string]string
 
-func (p *Password) Get(key string) string {
-	switch key {
-	case "ADMIN_PASSWORD":
-		return p.AdminPassword
-	case "AUTH_TOKEN":
-		return p.AuthToken
-	case "READONLY_USER_PASSWORD":
-		return p.ReadOnlyUserPassword
-	case "USER_PASSWORD":
-		return p.UserPassword
+// Get returns the value of key, or an error if the secret does not contain it.
+func (p Password) Get(key string) (string, error) {
+	if v, ok := p[key]; ok {
+		return v, nil
 	}
 
-	return p.ReadOnlyUserPassword
+	return "", fmt.Errorf("key %q not found in secret", key)
 }
 
 func Compact(d []string) []string {
@@ -45,25 +54,208 @@ func Compact(d []string) []string {
 }
 
 func getPassword(secretId string, session *session.Session) (Password, error) {
+	password, _, err := getPasswordStage(secretId, "AWSCURRENT", session)
+
+	return password, err
+}
+
+// getPasswordStage returns the password keys of the secret version with the given staging label, and its version id.
+func getPasswordStage(secretId string, stage string, session *session.Session) (Password, string, error) {
 	secretsManagerClient := secretsmanager.New(session)
 	password := Password{}
 
-	gsvi := &secretsmanager.GetSecretValueInput{
+	document, versionId, err := getSecretDocumentStage(secretsManagerClient, secretId, stage)
+
+	if err != nil {
+		return password, versionId, err
+	}
+
+	for k, v := range document {
+		if s, ok := v.(string); ok {
+			password[k] = s
+		}
+	}
+
+	return password, versionId, nil
+}
+
+// getSecretDocument returns the current json document of a secret along with its version id.
+func getSecretDocument(svc *secretsmanager.SecretsManager, secretId string) (map[string]interface{}, string, error) {
+	return getSecretDocumentStage(svc, secretId, "AWSCURRENT")
+}
+
+func getSecretDocumentStage(svc *secretsmanager.SecretsManager, secretId string, stage string) (map[string]interface{}, string, error) {
+	document := map[string]interface{}{}
+
+	gsvo, err := svc.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(secretId),
+		VersionStage: aws.String(stage),
+	})
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if gsvo.SecretString != nil && *gsvo.SecretString != "" {
+		if err := json.Unmarshal([]byte(*gsvo.SecretString), &document); err != nil {
+			return nil, "", fmt.Errorf("error parsing secret (%s): %w", secretId, err)
+		}
+	}
+
+	return document, aws.StringValue(gsvo.VersionId), nil
+}
+
+// isSecretNotFound returns true if the secret, or the requested version of it, does not exist.
+// Callers treating a secret without any value as empty check for it explicitly.
+func isSecretNotFound(err error) bool {
+	return tfawserr.ErrCodeEquals(err, secretsmanager.ErrCodeResourceNotFoundException)
+}
+
+// getSecretVersionId returns the version id holding the given staging label, or "" if there is none.
+func getSecretVersionId(svc *secretsmanager.SecretsManager, secretId string, stage string) (string, error) {
+	dso, err := svc.DescribeSecret(&secretsmanager.DescribeSecretInput{
 		SecretId: aws.String(secretId),
+	})
+
+	if err != nil {
+		return "", err
 	}
 
-	if gsvo, err := secretsManagerClient.GetSecretValue(gsvi); err != nil {
-		return password, err
-	} else if err := json.Unmarshal([]byte(*gsvo.SecretString), &password); err != nil {
-		return password, err
+	for versionId, stages := range dso.VersionIdsToStages {
+		for _, s := range stages {
+			if aws.StringValue(s) == stage {
+				return versionId, nil
+			}
+		}
 	}
 
-	return password, nil
+	return "", nil
+}
+
+// putSecretDocument writes document as a new version of the secret, provided that versionId is still
+// the current version. The new version is staged first and only made current by moving AWSCURRENT away
+// from versionId, which Secrets Manager refuses once another writer has moved it, so a conflicting write
+// never becomes current.
+func putSecretDocument(svc *secretsmanager.SecretsManager, secretId string, document map[string]interface{}, versionId string) error {
+	secretString, err := json.Marshal(document)
+
+	if err != nil {
+		return err
+	}
+
+	pvo, err := svc.PutSecretValue(&secretsmanager.PutSecretValueInput{
+		SecretId:           aws.String(secretId),
+		SecretString:       aws.String(string(secretString)),
+		ClientRequestToken: aws.String(resource.PrefixedUniqueId("better-")),
+		VersionStages:      aws.StringSlice([]string{secretStagePending}),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	newVersionId := aws.StringValue(pvo.VersionId)
+
+	input := &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:        aws.String(secretId),
+		VersionStage:    aws.String("AWSCURRENT"),
+		MoveToVersionId: aws.String(newVersionId),
+	}
+
+	// Without a version to replace, the move only succeeds if no other writer made a version current
+	if versionId != "" {
+		input.RemoveFromVersionId = aws.String(versionId)
+	}
+
+	_, moveErr := svc.UpdateSecretVersionStage(input)
+
+	// The label is not needed anymore, a version without labels is deprecated by Secrets Manager. Another
+	// writer may already have taken it over, so failing to remove it is harmless.
+	if _, err := svc.UpdateSecretVersionStage(&secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:            aws.String(secretId),
+		VersionStage:        aws.String(secretStagePending),
+		RemoveFromVersionId: aws.String(newVersionId),
+	}); err != nil {
+		log.Printf("[DEBUG] removing %s from secret (%s) version %s: %s", secretStagePending, secretId, newVersionId, err)
+	}
+
+	if moveErr != nil {
+		if current, err := getSecretVersionId(svc, secretId, "AWSCURRENT"); err == nil && current != versionId && current != newVersionId {
+			return &ConcurrentModificationError{SecretId: secretId}
+		}
+
+		return moveErr
+	}
+
+	return nil
+}
+
+// ConcurrentModificationError is returned when a secret changed while it was being updated.
+type ConcurrentModificationError struct {
+	SecretId string
+}
+
+func (e *ConcurrentModificationError) Error() string {
+	return fmt.Sprintf("secret (%s) was modified concurrently", e.SecretId)
+}
+
+// updateSecret applies fn to the current document of the secret and writes the result back,
+// retrying when the secret is modified concurrently. A conflicting write never becomes current, so
+// retrying re-applies fn on top of the other writer's version instead of dropping it.
+func updateSecret(svc *secretsmanager.SecretsManager, secretId string, fn func(map[string]interface{})) error {
+	var cme *ConcurrentModificationError
+
+	for i := 0; i < secretUpdateAttempts; i++ {
+		document, versionId, err := getSecretDocument(svc, secretId)
+
+		// A secret without any value starts out empty
+		if isSecretNotFound(err) {
+			document, versionId, err = map[string]interface{}{}, "", nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		fn(document)
+
+		if err := putSecretDocument(svc, secretId, document, versionId); !errors.As(err, &cme) {
+			return err
+		}
+	}
+
+	return cme
+}
+
+// writePassword merges the password keys into the secret, leaving other keys untouched.
+func writePassword(svc *secretsmanager.SecretsManager, secretId string, password Password) error {
+	return updateSecret(svc, secretId, func(document map[string]interface{}) {
+		for k, v := range password {
+			document[k] = v
+		}
+	})
+}
+
+func getSortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
 }
 
 func getSession() *session.Session {
+	return getRegionSession("us-east-1")
+}
+
+// getRegionSession returns a session for resources living outside of the default region.
+func getRegionSession(region string) *session.Session {
 	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("us-east-1")},
+		Region: aws.String(region)},
 	)
 
 	if err == nil {
@@ -78,18 +270,133 @@ func getSecretId(d *schema.ResourceData) string {
 	return d.Get("secret_id").(string)
 }
 
-func generateRandomPassword(svc *secretsmanager.SecretsManager) string {
+// onDestroySchema returns the on_destroy attribute restricted to the given policies.
+func onDestroySchema(policies ...string) *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeString,
+		Optional:     true,
+		Default:      OnDestroyRetain,
+		ValidateFunc: validation.StringInSlice(policies, false),
+		Description:  "what to do with the credentials on destroy, one of: " + strings.Join(policies, ", "),
+	}
+}
+
+func getOnDestroy(d *schema.ResourceData) string {
+	return d.Get("on_destroy").(string)
+}
+
+// clearSecret removes the given keys from the secret, leaving other keys untouched.
+func clearSecret(secretId string, keys []string, session *session.Session) error {
+	secretsManager := secretsmanager.New(session)
+
+	err := updateSecret(secretsManager, secretId, func(document map[string]interface{}) {
+		for _, k := range keys {
+			delete(document, k)
+		}
+	})
+
+	if err != nil {
+		return fmt.Errorf("error clearing secret (%s): %w", secretId, err)
+	}
+
+	return nil
+}
+
+// keysSchema returns the keys attribute listing which secret keys to generate.
+func keysSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		Computed:    true,
+		ForceNew:    true,
+		Description: "json keys of the secret to generate passwords for",
+		Elem: &schema.Schema{
+			Type:         schema.TypeString,
+			ValidateFunc: validation.StringIsNotEmpty,
+		},
+	}
+}
+
+// getKeys returns the configured keys, falling back to defaults when none are set.
+func getKeys(d *schema.ResourceData, defaults []string) []string {
+	keys := make([]string, 0)
+
+	for _, k := range d.Get("keys").([]interface{}) {
+		keys = append(keys, k.(string))
+	}
+
+	if len(keys) == 0 {
+		return defaults
+	}
+
+	return keys
+}
+
+func includePunctuationSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Default:     false,
+		ForceNew:    true,
+		Description: "generate passwords with upper and lower case letters, digits and punctuation, as required by OpenSearch",
+	}
+}
+
+func generatePassword(svc *secretsmanager.SecretsManager, keys []string, includePunctuation bool) (Password, error) {
+	password := Password{}
+
+	for _, k := range keys {
+		var p string
+		var err error
+
+		if includePunctuation {
+			p, err = generateComplexPassword(svc)
+		} else {
+			p, err = generateRandomPassword(svc)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		password[k] = p
+	}
+
+	return password, nil
+}
+
+// generateRandomPassword returns an alphanumeric password with upper and lower case letters and digits,
+// as required by Redshift among others.
+func generateRandomPassword(svc *secretsmanager.SecretsManager) (string, error) {
 	gpi := &secretsmanager.GetRandomPasswordInput{
-		ExcludePunctuation: aws.Bool(true),
-		PasswordLength:     aws.Int64(32),
+		ExcludePunctuation:      aws.Bool(true),
+		RequireEachIncludedType: aws.Bool(true),
+		PasswordLength:          aws.Int64(32),
 	}
 
 	gpo, err := svc.GetRandomPassword(gpi)
 
 	if err != nil {
-		fmt.Println(err.Error())
-		return "FAILED_TO_GENERATE_RANDOM_PASSWORD"
+		return "", fmt.Errorf("error generating random password: %w", err)
+	}
+
+	return aws.StringValue(gpo.RandomPassword), nil
+}
+
+// generateComplexPassword returns a password containing every character type, leaving out
+// characters that need escaping in connection strings.
+func generateComplexPassword(svc *secretsmanager.SecretsManager) (string, error) {
+	gpi := &secretsmanager.GetRandomPasswordInput{
+		ExcludeCharacters:       aws.String(`"'/\@:?#%`),
+		RequireEachIncludedType: aws.Bool(true),
+		PasswordLength:          aws.Int64(32),
+	}
+
+	gpo, err := svc.GetRandomPassword(gpi)
+
+	if err != nil {
+		return "", fmt.Errorf("error generating random password: %w", err)
 	}
 
-	return *gpo.RandomPassword
+	return aws.StringValue(gpo.RandomPassword), nil
 }
@@ -0,0 +1,94 @@
+package better
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourcePassword() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourcePasswordRead,
+		Schema: map[string]*schema.Schema{
+			"secret_id": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "id of secret",
+			},
+			"version_stage": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "AWSCURRENT",
+				Description: "staging label of the secret version to read",
+			},
+			"version_id": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "id of the secret version that was read",
+			},
+			"keys": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "json keys of the secret",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"values": {
+				Type:        schema.TypeMap,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "map of json key to password",
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(60 * time.Second),
+		},
+	}
+}
+
+func dataSourcePasswordRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	secretId := getSecretId(d)
+	versionStage := d.Get("version_stage").(string)
+
+	p, versionId, err := getPasswordStage(secretId, versionStage, getSession())
+
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("error reading secret (%s): %w", secretId, err))
+	}
+
+	keys := make([]string, 0, len(p))
+	values := make(map[string]interface{}, len(p))
+
+	for k, v := range p {
+		keys = append(keys, k)
+		values[k] = v
+	}
+
+	sort.Strings(keys)
+
+	if err := d.Set("version_id", versionId); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set("keys", keys); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := d.Set("values", values); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(secretId)
+
+	return diags
+}
@@ -0,0 +1,112 @@
+package better
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceSdmCredentialStatus() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceSdmCredentialStatusRead,
+		Schema: map[string]*schema.Schema{
+			"secret_id": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "id of secret",
+			},
+			"key": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "json key of the password in the secret",
+			},
+			"sdm_id": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "id of sdm resource",
+			},
+			"in_sync": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "whether the sdm resource holds the password of the secret, or references it in a secret store",
+			},
+			"resource_type": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "type of the sdm resource",
+			},
+			"name": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "name of the sdm resource",
+			},
+			"healthy": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "whether sdm reports the resource as reachable with valid credentials",
+			},
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(60 * time.Second),
+		},
+	}
+}
+
+func dataSourceSdmCredentialStatusRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	secretId := getSecretId(d)
+	key := d.Get("key").(string)
+	sdmId := d.Get("sdm_id").(string)
+
+	p, err := getPassword(secretId, getSession())
+
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("error reading secret (%s): %w", secretId, err))
+	}
+
+	password, err := p.Get(key)
+
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	client, err := getSdmClient()
+
+	if err != nil {
+		return diag.FromErr(err)
+	} else if client == nil {
+		return diag.FromErr(errors.New("SDM_API_ACCESS_KEY and SDM_API_SECRET_KEY are required to read sdm credential status"))
+	}
+
+	r, err := client.Resources().Get(ctx, sdmId)
+
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("error reading sdm resource (%s): %w", sdmId, err))
+	}
+
+	credentials, err := getSdmCredentials(r.Resource)
+
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// Resources backed by a secret store hold the path of the password instead of a copy
+	if r.Resource.GetSecretStoreID() != "" {
+		d.Set("in_sync", credentials.Password == getSdmSecretPath(secretId, key))
+	} else {
+		d.Set("in_sync", credentials.Password == password)
+	}
+	d.Set("resource_type", credentials.Type)
+	d.Set("name", r.Resource.GetName())
+	d.Set("healthy", credentials.Healthy)
+
+	d.SetId(strings.Join([]string{secretId, key, sdmId}, "-"))
+
+	return diags
+}
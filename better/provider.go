@@ -7,12 +7,23 @@ import (
 func Provider() *schema.Provider {
 	return &schema.Provider{
 		ResourcesMap: map[string]*schema.Resource{
-			"better_database_password":             resourceDatabasePassword(),
-			"better_database_password_association": resourceDatabasePasswordAssociation(),
-			"better_mq_password":                   resourceMqPassword(),
-			"better_mq_password_association":       resourceMqPasswordAssociation(),
-			"better_cache_password":                resourceCachePassword(),
-			"better_cache_password_association":    resourceCachePasswordAssociation(),
+			"better_database_password":               resourceDatabasePassword(),
+			"better_database_password_association":   resourceDatabasePasswordAssociation(),
+			"better_mq_password":                     resourceMqPassword(),
+			"better_mq_password_association":         resourceMqPasswordAssociation(),
+			"better_cache_password":                  resourceCachePassword(),
+			"better_msk_scram_password":              resourceMskScramPassword(),
+			"better_cache_password_association":      resourceCachePasswordAssociation(),
+			"better_memorydb_password_association":   resourceMemoryDbPasswordAssociation(),
+			"better_docdb_password_association":      resourceDocDbPasswordAssociation(),
+			"better_redshift_password_association":   resourceRedshiftPasswordAssociation(),
+			"better_opensearch_password_association": resourceOpenSearchPasswordAssociation(),
+			"better_rds_proxy_auth_association":      resourceRdsProxyAuthAssociation(),
+			"better_redis_password_association":      resourceRedisPasswordAssociation(),
+		},
+		DataSourcesMap: map[string]*schema.Resource{
+			"better_password":              dataSourcePassword(),
+			"better_sdm_credential_status": dataSourceSdmCredentialStatus(),
 		},
 	}
 }
@@ -0,0 +1,135 @@
+package better
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	rabbitMqRequestTimeout = 30 * time.Second
+)
+
+// RabbitMqManagement is a minimal client for the RabbitMQ management HTTP API.
+type RabbitMqManagement struct {
+	Endpoint string
+	Username string
+	Password string
+	client   *http.Client
+}
+
+// rabbitMqUser is passed through with its tags untouched, since they are a comma separated
+// string before RabbitMQ 3.9 and a list afterwards.
+type rabbitMqUser struct {
+	Name     string          `json:"name,omitempty"`
+	Password string          `json:"password,omitempty"`
+	Tags     json.RawMessage `json:"tags"`
+}
+
+// RabbitMqManagementError is returned for non successful responses of the management API.
+type RabbitMqManagementError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *RabbitMqManagementError) Error() string {
+	return fmt.Sprintf("RabbitMQ management API %s %s returned %d: %s", e.Method, e.Path, e.StatusCode, e.Body)
+}
+
+func newRabbitMqManagement(endpoint string, username string, password string) *RabbitMqManagement {
+	return &RabbitMqManagement{
+		Endpoint: strings.TrimRight(endpoint, "/"),
+		Username: username,
+		Password: password,
+		client:   &http.Client{Timeout: rabbitMqRequestTimeout},
+	}
+}
+
+func (r *RabbitMqManagement) do(method string, path string, in interface{}, out interface{}) error {
+	var body bytes.Buffer
+
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, r.Endpoint+path, &body)
+
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(r.Username, r.Password)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var b bytes.Buffer
+		b.ReadFrom(resp.Body)
+
+		return &RabbitMqManagementError{
+			Method:     method,
+			Path:       path,
+			StatusCode: resp.StatusCode,
+			Body:       strings.TrimSpace(b.String()),
+		}
+	}
+
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	return nil
+}
+
+// Authenticated checks whether the management API accepts the client's credential.
+func (r *RabbitMqManagement) Authenticated() (bool, error) {
+	err := r.do(http.MethodGet, "/api/whoami", nil, nil)
+
+	if e, ok := err.(*RabbitMqManagementError); ok && e.StatusCode == http.StatusUnauthorized {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// UpdatePassword sets the password of an existing user, keeping its tags.
+func (r *RabbitMqManagement) UpdatePassword(username string, password string) error {
+	path := "/api/users/" + url.PathEscape(username)
+	user := rabbitMqUser{}
+
+	if err := r.do(http.MethodGet, path, nil, &user); err != nil {
+		return err
+	}
+
+	if len(user.Tags) == 0 {
+		user.Tags = json.RawMessage(`""`)
+	}
+
+	return r.do(http.MethodPut, path, &rabbitMqUser{Password: password, Tags: user.Tags}, nil)
+}
+
+// DeleteUser removes a user, succeeding when it does not exist.
+func (r *RabbitMqManagement) DeleteUser(username string) error {
+	err := r.do(http.MethodDelete, "/api/users/"+url.PathEscape(username), nil, nil)
+
+	if e, ok := err.(*RabbitMqManagementError); ok && e.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return err
+}
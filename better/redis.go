@@ -0,0 +1,194 @@
+package better
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisDialTimeout    = 10 * time.Second
+	redisCommandTimeout = 30 * time.Second
+)
+
+// RedisClient is a minimal client for the Redis protocol, enough to authenticate and manage credentials.
+type RedisClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// RedisError is an error reply of the server.
+type RedisError struct {
+	Message string
+}
+
+func (e *RedisError) Error() string {
+	return "redis: " + e.Message
+}
+
+// isRedisAuthError returns true if the server rejected the credential.
+func isRedisAuthError(err error) bool {
+	e, ok := err.(*RedisError)
+
+	return ok && (strings.HasPrefix(e.Message, "WRONGPASS") ||
+		strings.HasPrefix(e.Message, "NOAUTH") ||
+		strings.Contains(e.Message, "invalid password"))
+}
+
+func dialRedis(host string, port int, useTls bool) (*RedisClient, error) {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: redisDialTimeout}
+
+	var conn net.Conn
+	var err error
+
+	if useTls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to Redis (%s): %w", address, err)
+	}
+
+	return &RedisClient{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// openRedis connects and authenticates, as username unless it is empty.
+func openRedis(host string, port int, useTls bool, username string, password string) (*RedisClient, error) {
+	client, err := dialRedis(host, port, useTls)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Auth(username, password); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (c *RedisClient) Close() error {
+	return c.conn.Close()
+}
+
+// Auth authenticates the connection. Servers without a password accept any credential, which proves
+// nothing about it, so they are reported as an error.
+func (c *RedisClient) Auth(username string, password string) error {
+	args := []string{"AUTH", password}
+
+	if username != "" {
+		args = []string{"AUTH", username, password}
+	}
+
+	_, err := c.Do(args...)
+
+	if e, ok := err.(*RedisError); ok && (strings.Contains(e.Message, "no password is set") ||
+		strings.Contains(e.Message, "without any password configured")) {
+		return fmt.Errorf("redis server has no password set: %w", err)
+	}
+
+	return err
+}
+
+// Do sends a command and returns its reply, which is a string, an int64, nil or a []interface{} of those.
+func (c *RedisClient) Do(args ...string) (interface{}, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(redisCommandTimeout)); err != nil {
+		return nil, err
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+func (c *RedisClient) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", fmt.Errorf("redis: malformed reply %q", line)
+	}
+
+	return line[:len(line)-2], nil
+}
+
+func (c *RedisClient) readReply() (interface{}, error) {
+	line, err := c.readLine()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, &RedisError{Message: line[1:]}
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		buf := make([]byte, n+2)
+
+		if _, err := io.ReadFull(c.reader, buf); err != nil {
+			return nil, err
+		}
+
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		values := make([]interface{}, 0, n)
+
+		for i := 0; i < n; i++ {
+			v, err := c.readReply()
+
+			if err != nil {
+				if _, ok := err.(*RedisError); !ok {
+					return nil, err
+				}
+			}
+
+			values = append(values, v)
+		}
+
+		return values, nil
+	}
+
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
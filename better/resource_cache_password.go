@@ -2,15 +2,15 @@ package better
 
 import (
 	"context"
-	"encoding/json"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
+var cachePasswordDefaultKeys = []string{"AUTH_TOKEN"}
+
 func resourceCachePassword() *schema.Resource {
 	return &schema.Resource{
 		CreateContext: resourceCachePasswordCreate,
@@ -26,6 +26,9 @@ func resourceCachePassword() *schema.Resource {
 				Required:    true,
 				Description: "id of secret",
 			},
+			"include_punctuation": includePunctuationSchema(),
+			"keys":                keysSchema(),
+			"on_destroy":          onDestroySchema(OnDestroyRetain, OnDestroyClearSecret),
 		},
 		Timeouts: &schema.ResourceTimeout{
 			Default: schema.DefaultTimeout(60 * time.Second),
@@ -38,11 +41,8 @@ func resourceCachePasswordCreate(ctx context.Context, d *schema.ResourceData, m
 
 	secretsManager := secretsmanager.New(getSession())
 
-	secret := Password{
-		AuthToken: generateRandomPassword(secretsManager),
-	}
-
-	secretString, err := json.Marshal(secret)
+	keys := getKeys(d, cachePasswordDefaultKeys)
+	secret, err := generatePassword(secretsManager, keys, d.Get("include_punctuation").(bool))
 
 	if err != nil {
 		return diag.FromErr(err)
@@ -50,14 +50,11 @@ func resourceCachePasswordCreate(ctx context.Context, d *schema.ResourceData, m
 
 	secretId := getSecretId(d)
 
-	psvi := &secretsmanager.PutSecretValueInput{
-		SecretId:     aws.String(secretId),
-		SecretString: aws.String(string(secretString)),
+	if err := writePassword(secretsManager, secretId, secret); err != nil {
+		return diag.FromErr(err)
 	}
 
-	_, err = secretsManager.PutSecretValue(psvi)
-
-	if err != nil {
+	if err := d.Set("keys", keys); err != nil {
 		return diag.FromErr(err)
 	}
 
@@ -76,5 +73,12 @@ func resourceCachePasswordRead(ctx context.Context, d *schema.ResourceData, m in
 
 func resourceCachePasswordDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
+
+	if getOnDestroy(d) == OnDestroyClearSecret {
+		if err := clearSecret(getSecretId(d), getKeys(d, cachePasswordDefaultKeys), getSession()); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
 	return diags
 }
@@ -4,13 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/elasticache"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/hashicorp/aws-sdk-go-base/tfawserr"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
@@ -33,30 +33,53 @@ const (
 	ReplicationGroupStatusDeleting     = "deleting"
 	ReplicationGroupStatusCreateFailed = "create-failed"
 	ReplicationGroupStatusSnapshotting = "snapshotting"
+
+	GlobalReplicationGroupRolePrimary = "PRIMARY"
+
+	CacheClusterStatusAvailable             = "available"
+	CacheClusterStatusCreating              = "creating"
+	CacheClusterStatusModifying             = "modifying"
+	CacheClusterStatusRebootingClusterNodes = "rebooting cluster nodes"
+	CacheClusterStatusSnapshotting          = "snapshotting"
+
+	AuthTokenUpdateStrategyRotate = "ROTATE"
+	AuthTokenUpdateStrategySet    = "SET"
 )
 
 func getCachePasswordId(d *schema.ResourceData) string {
 	ids := []string{
 		getSecretId(d),
 		d.Get("replication_group_id").(string),
+		d.Get("cache_cluster_id").(string),
+		d.Get("global_replication_group_id").(string),
 		d.Get("sdm_id").(string),
 	}
 
 	return strings.Join(Compact(ids), "-")
 }
 
-func updateCachePassword(cacheId string, password string, session *session.Session) (bool, error) {
-	cacheClient := elasticache.New(session)
-
+func modifyCachePassword(cacheClient *elasticache.ElastiCache, cacheId string, password string, strategy string) error {
 	_, err := cacheClient.ModifyReplicationGroup(&elasticache.ModifyReplicationGroupInput{
 		ReplicationGroupId:      aws.String(cacheId),
 		ApplyImmediately:        aws.Bool(true),
 		AuthToken:               aws.String(password),
-		AuthTokenUpdateStrategy: aws.String("ROTATE"),
+		AuthTokenUpdateStrategy: aws.String(strategy),
 	})
 
 	if err != nil {
-		return false, fmt.Errorf("error updating ElastiCache password (%s): %w", cacheId, err)
+		return fmt.Errorf("error updating ElastiCache password (%s): %w", cacheId, err)
+	}
+
+	return nil
+}
+
+func updateCachePassword(cacheId string, password string, strategy string, session *session.Session) (bool, error) {
+	cacheClient := elasticache.New(session)
+
+	err := modifyCachePassword(cacheClient, cacheId, password, strategy)
+
+	if err != nil {
+		return false, err
 	}
 
 	if _, err := ReplicationGroupAvailable(cacheClient, cacheId); err != nil {
@@ -66,6 +89,111 @@ func updateCachePassword(cacheId string, password string, session *session.Sessi
 	return err == nil, err
 }
 
+func updateCacheClusterPassword(clusterId string, password string, strategy string, session *session.Session) (bool, error) {
+	cacheClient := elasticache.New(session)
+
+	_, err := cacheClient.ModifyCacheCluster(&elasticache.ModifyCacheClusterInput{
+		CacheClusterId:          aws.String(clusterId),
+		ApplyImmediately:        aws.Bool(true),
+		AuthToken:               aws.String(password),
+		AuthTokenUpdateStrategy: aws.String(strategy),
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("error updating ElastiCache Cluster password (%s): %w", clusterId, err)
+	}
+
+	if _, err := CacheClusterAvailable(cacheClient, clusterId); err != nil {
+		return false, fmt.Errorf("error waiting for ElastiCache Cluster (%s) update: %w", clusterId, err)
+	}
+
+	return err == nil, err
+}
+
+// updateGlobalCachePassword sets the auth token on every member of a global datastore, primary first,
+// each in its own region, and then waits for all of them.
+func updateGlobalCachePassword(globalId string, password string, strategy string, session *session.Session) (bool, error) {
+	group, err := GlobalReplicationGroupByID(elasticache.New(session), globalId)
+
+	if err != nil {
+		return false, fmt.Errorf("error reading ElastiCache Global Replication Group (%s): %w", globalId, err)
+	}
+
+	members := make([]*elasticache.GlobalReplicationGroupMember, 0, len(group.Members))
+
+	for _, member := range group.Members {
+		if aws.StringValue(member.Role) == GlobalReplicationGroupRolePrimary {
+			members = append([]*elasticache.GlobalReplicationGroupMember{member}, members...)
+		} else {
+			members = append(members, member)
+		}
+	}
+
+	for _, member := range members {
+		cacheClient := elasticache.New(getRegionSession(aws.StringValue(member.ReplicationGroupRegion)))
+
+		if err := modifyCachePassword(cacheClient, aws.StringValue(member.ReplicationGroupId), password, strategy); err != nil {
+			return false, err
+		}
+	}
+
+	for _, member := range members {
+		cacheId := aws.StringValue(member.ReplicationGroupId)
+		cacheClient := elasticache.New(getRegionSession(aws.StringValue(member.ReplicationGroupRegion)))
+
+		if _, err := ReplicationGroupAvailable(cacheClient, cacheId); err != nil {
+			return false, fmt.Errorf("error waiting for ElastiCache Instance (%s) in %s update: %w", cacheId, aws.StringValue(member.ReplicationGroupRegion), err)
+		}
+	}
+
+	return len(members) > 0, nil
+}
+
+// GlobalReplicationGroupByID retrieves an ElastiCache Global Replication Group with its members by id.
+func GlobalReplicationGroupByID(conn *elasticache.ElastiCache, id string) (*elasticache.GlobalReplicationGroup, error) {
+	input := &elasticache.DescribeGlobalReplicationGroupsInput{
+		GlobalReplicationGroupId: aws.String(id),
+		ShowMemberInfo:           aws.Bool(true),
+	}
+	output, err := conn.DescribeGlobalReplicationGroups(input)
+	if tfawserr.ErrCodeEquals(err, elasticache.ErrCodeGlobalReplicationGroupNotFoundFault) {
+		return nil, &resource.NotFoundError{
+			LastError:   err,
+			LastRequest: input,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if output == nil || len(output.GlobalReplicationGroups) == 0 || output.GlobalReplicationGroups[0] == nil {
+		return nil, &resource.NotFoundError{
+			Message:     "empty result",
+			LastRequest: input,
+		}
+	}
+
+	return output.GlobalReplicationGroups[0], nil
+}
+
+// updateCache sets the auth token of the replication group, cache cluster or global datastore of the
+// association, returning false when it has none.
+func updateCache(d *schema.ResourceData, password string, strategy string, session *session.Session) (bool, error) {
+	if globalId := d.Get("global_replication_group_id").(string); globalId != "" {
+		return updateGlobalCachePassword(globalId, password, strategy, session)
+	}
+
+	if cacheId := d.Get("replication_group_id").(string); cacheId != "" {
+		return updateCachePassword(cacheId, password, strategy, session)
+	}
+
+	if clusterId := d.Get("cache_cluster_id").(string); clusterId != "" {
+		return updateCacheClusterPassword(clusterId, password, strategy, session)
+	}
+
+	return false, nil
+}
+
 // ReplicationGroupByID retrieves an ElastiCache Replication Group by id.
 func ReplicationGroupByID(conn *elasticache.ElastiCache, id string) (*elasticache.ReplicationGroup, error) {
 	input := &elasticache.DescribeReplicationGroupsInput{
@@ -100,30 +228,63 @@ func NotFound(err error) bool {
 	return errors.As(err, &e)
 }
 
-func updateSdmRedis(id string, password string, ctx context.Context) (bool, error) {
-	accessKey := os.Getenv("SDM_API_ACCESS_KEY")
-	secretKey := os.Getenv("SDM_API_SECRET_KEY")
+// CacheClusterByID retrieves an ElastiCache Cache Cluster by id.
+func CacheClusterByID(conn *elasticache.ElastiCache, id string) (*elasticache.CacheCluster, error) {
+	input := &elasticache.DescribeCacheClustersInput{
+		CacheClusterId:    aws.String(id),
+		ShowCacheNodeInfo: aws.Bool(true),
+	}
+	output, err := conn.DescribeCacheClusters(input)
+	if tfawserr.ErrCodeEquals(err, elasticache.ErrCodeCacheClusterNotFoundFault) {
+		return nil, &resource.NotFoundError{
+			LastError:   err,
+			LastRequest: input,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	if accessKey == "" || secretKey == "" {
-		return false, nil
+	if output == nil || len(output.CacheClusters) == 0 || output.CacheClusters[0] == nil {
+		return nil, &resource.NotFoundError{
+			Message:     "empty result",
+			LastRequest: input,
+		}
 	}
 
-	if client, err := sdm.New(accessKey, secretKey); err != nil {
-		return err == nil, err
+	return output.CacheClusters[0], nil
+}
+
+// updateSdmRedis sets the password of a StrongDM Redis resource, which fronts ElastiCache and MemoryDB alike.
+func updateSdmRedis(id string, password string, ctx context.Context) (bool, error) {
+	if client, err := getSdmClient(); client == nil {
+		return false, err
 	} else {
 		if r, err := client.Resources().Get(ctx, id); err != nil {
 			return err == nil, err
 		} else {
-			redis := r.Resource.(*sdm.ElasticacheRedis)
-			redis.Password = password
+			switch r.Resource.(type) {
+			case *sdm.ElasticacheRedis, *sdm.Redis:
+			default:
+				return false, fmt.Errorf("sdm resource (%s) of type %T is not a Redis resource", id, r.Resource)
+			}
 
-			_, err := client.Resources().Update(ctx, redis)
+			if err := setSdmPlainCredentials(r.Resource, "", password); err != nil {
+				return false, err
+			}
+
+			_, err := client.Resources().Update(ctx, r.Resource)
 
 			return err == nil, err
 		}
 	}
 }
 
+// updateSdmRedisUser is updateSdmRedis for callers passing a username, which Redis resources do not take.
+func updateSdmRedisUser(id string, _ string, password string, ctx context.Context) (bool, error) {
+	return updateSdmRedis(id, password, ctx)
+}
+
 // ReplicationGroupStatus fetches the Replication Group and its Status
 func ReplicationGroupStatus(conn *elasticache.ElastiCache, replicationGroupID string) resource.StateRefreshFunc {
 	return func() (interface{}, string, error) {
@@ -161,6 +322,44 @@ func ReplicationGroupAvailable(conn *elasticache.ElastiCache, replicationGroupID
 	return nil, err
 }
 
+// CacheClusterStatus fetches the Cache Cluster and its Status
+func CacheClusterStatus(conn *elasticache.ElastiCache, cacheClusterID string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		cc, err := CacheClusterByID(conn, cacheClusterID)
+		if NotFound(err) {
+			return nil, "", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		return cc, aws.StringValue(cc.CacheClusterStatus), nil
+	}
+}
+
+// CacheClusterAvailable waits for a Cache Cluster to return Available
+func CacheClusterAvailable(conn *elasticache.ElastiCache, cacheClusterID string) (*elasticache.CacheCluster, error) {
+	stateConf := &resource.StateChangeConf{
+		Pending: []string{
+			CacheClusterStatusCreating,
+			CacheClusterStatusModifying,
+			CacheClusterStatusRebootingClusterNodes,
+			CacheClusterStatusSnapshotting,
+		},
+		Target:     []string{CacheClusterStatusAvailable},
+		Refresh:    CacheClusterStatus(conn, cacheClusterID),
+		Timeout:    CacheUpdateTimeout,
+		MinTimeout: replicationGroupAvailableMinTimeout,
+		Delay:      replicationGroupAvailableDelay,
+	}
+
+	outputRaw, err := stateConf.WaitForState()
+	if v, ok := outputRaw.(*elasticache.CacheCluster); ok {
+		return v, err
+	}
+	return nil, err
+}
+
 func resourceCachePasswordAssociation() *schema.Resource {
 	return &schema.Resource{
 		CreateContext: resourceCachePasswordAssociationCreate,
@@ -177,10 +376,25 @@ func resourceCachePasswordAssociation() *schema.Resource {
 				Description: "id of secret",
 			},
 			"replication_group_id": {
-				Type:        schema.TypeString,
-				Optional:    true,
-				Default:     "",
-				Description: "id of the ElastiCache replication group",
+				Type:          schema.TypeString,
+				Optional:      true,
+				Default:       "",
+				ConflictsWith: []string{"cache_cluster_id", "global_replication_group_id"},
+				Description:   "id of the ElastiCache replication group",
+			},
+			"cache_cluster_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Default:       "",
+				ConflictsWith: []string{"replication_group_id", "global_replication_group_id"},
+				Description:   "id of the standalone ElastiCache cache cluster, an alternative to replication_group_id",
+			},
+			"global_replication_group_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Default:       "",
+				ConflictsWith: []string{"replication_group_id", "cache_cluster_id"},
+				Description:   "id of the ElastiCache global datastore, whose member replication groups are rotated in their own regions",
 			},
 			"sdm_id": {
 				Type:        schema.TypeString,
@@ -188,9 +402,16 @@ func resourceCachePasswordAssociation() *schema.Resource {
 				Default:     "",
 				Description: "id of sdm resource",
 			},
+			"verify":               verifySchema(),
+			"wait_for_sdm_healthy": waitForSdmHealthySchema(),
+			"sdm_secret_store_id":  sdmSecretStoreIdSchema(),
+			"sdm_resource":         sdmResourceSchema(),
+			"sdm_resource_id":      sdmResourceIdSchema(),
+			"on_destroy":           onDestroySchema(OnDestroyRetain, OnDestroyScramble, OnDestroyRemoveSdmCredentials),
 		},
 		Timeouts: &schema.ResourceTimeout{
 			Default: schema.DefaultTimeout(60 * time.Second),
+			Create:  schema.DefaultTimeout(SdmHealthyTimeout),
 		},
 	}
 }
@@ -198,33 +419,140 @@ func resourceCachePasswordAssociation() *schema.Resource {
 func resourceCachePasswordAssociationCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
-	secretId := getSecretId(d)
-	cacheId := d.Get("replication_group_id").(string)
-	sdmId := d.Get("sdm_id").(string)
 	session := getSession()
 
-	if p, err := getPassword(secretId, session); err != nil {
+	push := func(p Password) diag.Diagnostics {
+		return pushCachePassword(ctx, d, p, session)
+	}
+
+	probe := func(v Verify, p Password) error {
+		password, err := p.Get("AUTH_TOKEN")
+
+		if err != nil {
+			return err
+		}
+
+		return verifyCachePassword(d, v, password, session)
+	}
+
+	if diags = pushVerified(d, session, push, probe); diags.HasError() {
+		return diags
+	}
+
+	sdmResourceId, err := createSdmResource(ctx, d, SdmResourceTypeElasticacheRedis, "AUTH_TOKEN", "", session)
+
+	if err != nil {
+		return append(diags, diag.FromErr(err)...)
+	}
+
+	if sdmResourceId != "" {
+		d.Set("sdm_resource_id", sdmResourceId)
+
+		// Keep the created sdm resource in state even if waiting fails, so it is deleted on replace
+		d.SetId(getCachePasswordId(d))
+	}
+
+	if diags = append(diags, waitForSdmHealthy(ctx, d, Compact([]string{d.Get("sdm_id").(string), sdmResourceId}), d.Timeout(schema.TimeoutCreate))...); diags.HasError() {
+		return diags
+	}
+
+	d.SetId(getCachePasswordId(d))
+
+	return diags
+}
+
+// pushCachePassword sets the auth token on the cache and on StrongDM.
+func pushCachePassword(ctx context.Context, d *schema.ResourceData, p Password, session *session.Session) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	sdmId := d.Get("sdm_id").(string)
+
+	if password, err := p.Get("AUTH_TOKEN"); err != nil {
 		return diag.FromErr(err)
 	} else {
 
-		password := p.Get("AUTH_TOKEN")
-
-		if cacheId != "" {
-			if _, err := updateCachePassword(cacheId, password, session); err != nil {
+		if updated, err := updateCache(d, password, AuthTokenUpdateStrategyRotate, session); err != nil {
+			return diag.FromErr(err)
+		} else if updated && sdmId != "" {
+			if _, err := updateSdm(ctx, d, sdmId, "AUTH_TOKEN", "", password, updateSdmRedisUser); err != nil {
 				return diag.FromErr(err)
 			}
+		}
+	}
+
+	return diags
+}
+
+// getCacheEndpoint returns the endpoint to AUTH against for the cache of the association, and whether
+// it requires TLS. Global datastores are checked on their primary member.
+func getCacheEndpoint(d *schema.ResourceData, session *session.Session) (*elasticache.Endpoint, bool, error) {
+	cacheId := d.Get("replication_group_id").(string)
+	cacheClient := elasticache.New(session)
+
+	if globalId := d.Get("global_replication_group_id").(string); globalId != "" {
+		group, err := GlobalReplicationGroupByID(cacheClient, globalId)
+
+		if err != nil {
+			return nil, false, fmt.Errorf("error reading ElastiCache Global Replication Group (%s): %w", globalId, err)
+		}
 
-			if sdmId != "" {
-				if _, err := updateSdmRedis(sdmId, password, ctx); err != nil {
-					return diag.FromErr(err)
-				}
+		for _, member := range group.Members {
+			if aws.StringValue(member.Role) == GlobalReplicationGroupRolePrimary {
+				cacheId = aws.StringValue(member.ReplicationGroupId)
+				cacheClient = elasticache.New(getRegionSession(aws.StringValue(member.ReplicationGroupRegion)))
 			}
 		}
 	}
 
-	d.SetId(getCachePasswordId(d))
+	if clusterId := d.Get("cache_cluster_id").(string); clusterId != "" {
+		cluster, err := CacheClusterByID(cacheClient, clusterId)
 
-	return diags
+		if err != nil {
+			return nil, false, fmt.Errorf("error reading ElastiCache Cluster (%s): %w", clusterId, err)
+		}
+
+		if len(cluster.CacheNodes) == 0 || cluster.CacheNodes[0].Endpoint == nil {
+			return nil, false, fmt.Errorf("ElastiCache Cluster (%s) has no endpoint", clusterId)
+		}
+
+		return cluster.CacheNodes[0].Endpoint, aws.BoolValue(cluster.TransitEncryptionEnabled), nil
+	}
+
+	if cacheId == "" {
+		return nil, false, nil
+	}
+
+	rg, err := ReplicationGroupByID(cacheClient, cacheId)
+
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading ElastiCache Replication Group (%s): %w", cacheId, err)
+	}
+
+	if rg.ConfigurationEndpoint != nil {
+		return rg.ConfigurationEndpoint, aws.BoolValue(rg.TransitEncryptionEnabled), nil
+	}
+
+	if len(rg.NodeGroups) == 0 || rg.NodeGroups[0].PrimaryEndpoint == nil {
+		return nil, false, fmt.Errorf("ElastiCache Replication Group (%s) has no endpoint", cacheId)
+	}
+
+	return rg.NodeGroups[0].PrimaryEndpoint, aws.BoolValue(rg.TransitEncryptionEnabled), nil
+}
+
+// verifyCachePassword checks a Redis AUTH with the token against the cache.
+func verifyCachePassword(d *schema.ResourceData, v Verify, password string, session *session.Session) error {
+	endpoint, useTls, err := getCacheEndpoint(d, session)
+
+	if err != nil || endpoint == nil {
+		return err
+	}
+
+	host := aws.StringValue(endpoint.Address)
+	port := int(aws.Int64Value(endpoint.Port))
+
+	return v.Run(fmt.Sprintf("Redis AUTH at %s:%d", host, port), func() error {
+		return verifyRedisAuth(host, port, useTls, "", password)
+	})
 }
 
 func resourceCachePasswordAssociationRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
@@ -237,5 +565,37 @@ func resourceCachePasswordAssociationRead(ctx context.Context, d *schema.Resourc
 
 func resourceCachePasswordAssociationDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
+
+	sdmId := d.Get("sdm_id").(string)
+	session := getSession()
+
+	if err := deleteSdmResource(ctx, d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	switch getOnDestroy(d) {
+	case OnDestroyScramble:
+		password, err := generateRandomPassword(secretsmanager.New(session))
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		// ROTATE keeps the previous token valid, SET afterwards drops it
+		if updated, err := updateCache(d, password, AuthTokenUpdateStrategyRotate, session); err != nil {
+			return diag.FromErr(err)
+		} else if updated {
+			if _, err := updateCache(d, password, AuthTokenUpdateStrategySet, session); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	case OnDestroyRemoveSdmCredentials:
+		if sdmId != "" {
+			if _, err := updateSdmRedis(sdmId, "", ctx); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
 	return diags
 }
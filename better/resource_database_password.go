@@ -2,15 +2,91 @@ package better
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/hashicorp/aws-sdk-go-base/tfawserr"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
+const (
+	SecretFormatDefault = "default"
+	SecretFormatRds     = "rds"
+)
+
+var databasePasswordDefaultKeys = []string{"ADMIN_PASSWORD", "USER_PASSWORD", "READONLY_USER_PASSWORD"}
+
+// RdsSecret is the secret layout expected by the AWS RDS rotation Lambdas.
+type RdsSecret struct {
+	Engine    string `json:"engine,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Port      int64  `json:"port,omitempty"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	DbName    string `json:"dbname,omitempty"`
+	MasterArn string `json:"masterarn,omitempty"`
+}
+
+func getRdsSecret(secretId string, session *session.Session) (RdsSecret, error) {
+	secret := RdsSecret{}
+
+	document, _, err := getSecretDocument(secretsmanager.New(session), secretId)
+
+	if err != nil {
+		return secret, err
+	}
+
+	secret.Engine, _ = document["engine"].(string)
+	secret.Host, _ = document["host"].(string)
+	secret.Username, _ = document["username"].(string)
+	secret.Password, _ = document["password"].(string)
+	secret.DbName, _ = document["dbname"].(string)
+	secret.MasterArn, _ = document["masterarn"].(string)
+
+	if port, ok := document["port"].(float64); ok {
+		secret.Port = int64(port)
+	}
+
+	if secret.Username == "" || secret.Password == "" {
+		return secret, fmt.Errorf("secret (%s) is not in rds format: username and password are required", secretId)
+	}
+
+	return secret, nil
+}
+
+// DBInstanceByID retrieves an RDS DB Instance by id.
+func DBInstanceByID(conn *rds.RDS, id string) (*rds.DBInstance, error) {
+	input := &rds.DescribeDBInstancesInput{
+		DBInstanceIdentifier: aws.String(id),
+	}
+	output, err := conn.DescribeDBInstances(input)
+	if tfawserr.ErrCodeEquals(err, rds.ErrCodeDBInstanceNotFoundFault) {
+		return nil, &resource.NotFoundError{
+			LastError:   err,
+			LastRequest: input,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if output == nil || len(output.DBInstances) == 0 || output.DBInstances[0] == nil {
+		return nil, &resource.NotFoundError{
+			Message:     "empty result",
+			LastRequest: input,
+		}
+	}
+
+	return output.DBInstances[0], nil
+}
+
 func resourceDatabasePassword() *schema.Resource {
 	return &schema.Resource{
 		CreateContext: resourceDatabasePasswordCreate,
@@ -20,12 +96,42 @@ func resourceDatabasePassword() *schema.Resource {
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
+		CustomizeDiff: resourceDatabasePasswordCustomizeDiff,
 		Schema: map[string]*schema.Schema{
 			"secret_id": {
 				Type:        schema.TypeString,
 				Required:    true,
 				Description: "id of secret",
 			},
+			"include_punctuation": includePunctuationSchema(),
+			"keys":                keysSchema(),
+			"format": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				Default:      SecretFormatDefault,
+				ValidateFunc: validation.StringInSlice([]string{SecretFormatDefault, SecretFormatRds}, false),
+				Description:  "layout of the secret, either default or rds",
+			},
+			"username": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "database user of the secret, required by the rds format",
+			},
+			"db_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "id of rds instance to read engine, host, port and dbname from, used by the rds format",
+			},
+			"master_secret_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "arn of the secret holding the master user, used by the rds format for alternating users rotation",
+			},
+			"on_destroy": onDestroySchema(OnDestroyRetain, OnDestroyClearSecret),
 		},
 		Timeouts: &schema.ResourceTimeout{
 			Default: schema.DefaultTimeout(60 * time.Second),
@@ -33,39 +139,111 @@ func resourceDatabasePassword() *schema.Resource {
 	}
 }
 
+// resourceDatabasePasswordCustomizeDiff rejects keys in rds format, which always holds a single password
+// key, instead of replacing the configured keys on every plan.
+func resourceDatabasePasswordCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if !d.NewValueKnown("format") || d.Get("format").(string) != SecretFormatRds || !d.NewValueKnown("keys") {
+		return nil
+	}
+
+	keys := d.Get("keys").([]interface{})
+
+	if len(keys) == 0 || (len(keys) == 1 && keys[0] == "password") {
+		return nil
+	}
+
+	return fmt.Errorf("keys cannot be set with format %q, which always uses the password key", SecretFormatRds)
+}
+
 func resourceDatabasePasswordCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
-	secretsManager := secretsmanager.New(getSession())
+	session := getSession()
+	secretsManager := secretsmanager.New(session)
+	secretId := getSecretId(d)
+
+	keys := getKeys(d, databasePasswordDefaultKeys)
+
+	if d.Get("format").(string) == SecretFormatRds {
+		keys = []string{"password"}
+
+		if err := writeRdsPassword(d, secretsManager, session); err != nil {
+			return diag.FromErr(err)
+		}
+	} else {
+		secret, err := generatePassword(secretsManager, keys, d.Get("include_punctuation").(bool))
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
 
-	secret := Password{
-		AdminPassword:        generateRandomPassword(secretsManager),
-		UserPassword:         generateRandomPassword(secretsManager),
-		ReadOnlyUserPassword: generateRandomPassword(secretsManager),
+		if err := writePassword(secretsManager, secretId, secret); err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
-	secretString, err := json.Marshal(secret)
+	if err := d.Set("keys", keys); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(secretId)
+
+	return diags
+}
+
+func writeRdsPassword(d *schema.ResourceData, secretsManager *secretsmanager.SecretsManager, session *session.Session) error {
+	password, err := generateRandomPassword(secretsManager)
 
 	if err != nil {
-		return diag.FromErr(err)
+		return err
 	}
 
-	secretId := getSecretId(d)
+	secret := RdsSecret{
+		Username:  d.Get("username").(string),
+		Password:  password,
+		MasterArn: d.Get("master_secret_id").(string),
+	}
 
-	psvi := &secretsmanager.PutSecretValueInput{
-		SecretId:     aws.String(secretId),
-		SecretString: aws.String(string(secretString)),
+	if secret.Username == "" {
+		return fmt.Errorf("username is required when format is %q", SecretFormatRds)
 	}
 
-	_, err = secretsManager.PutSecretValue(psvi)
+	if dbId := d.Get("db_id").(string); dbId != "" {
+		instance, err := DBInstanceByID(rds.New(session), dbId)
 
-	if err != nil {
-		return diag.FromErr(err)
+		if err != nil {
+			return fmt.Errorf("error reading RDS instance (%s): %w", dbId, err)
+		}
+
+		secret.Engine = aws.StringValue(instance.Engine)
+		secret.DbName = aws.StringValue(instance.DBName)
+
+		if instance.Endpoint != nil {
+			secret.Host = aws.StringValue(instance.Endpoint.Address)
+			secret.Port = aws.Int64Value(instance.Endpoint.Port)
+		}
 	}
 
-	d.SetId(secretId)
+	return updateSecret(secretsManager, getSecretId(d), func(document map[string]interface{}) {
+		document["username"] = secret.Username
+		document["password"] = secret.Password
 
-	return diags
+		if secret.Engine != "" {
+			document["engine"] = secret.Engine
+		}
+		if secret.Host != "" {
+			document["host"] = secret.Host
+		}
+		if secret.Port != 0 {
+			document["port"] = secret.Port
+		}
+		if secret.DbName != "" {
+			document["dbname"] = secret.DbName
+		}
+		if secret.MasterArn != "" {
+			document["masterarn"] = secret.MasterArn
+		}
+	})
 }
 
 func resourceDatabasePasswordRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
@@ -78,5 +256,12 @@ func resourceDatabasePasswordRead(ctx context.Context, d *schema.ResourceData, m
 
 func resourceDatabasePasswordDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
+
+	if getOnDestroy(d) == OnDestroyClearSecret {
+		if err := clearSecret(getSecretId(d), getKeys(d, databasePasswordDefaultKeys), getSession()); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
 	return diags
 }
@@ -2,15 +2,21 @@ package better
 
 import (
 	"context"
-	"os"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 	sdm "github.com/strongdm/strongdm-sdk-go"
 )
 
@@ -20,9 +26,148 @@ func getDatabasePasswordId(d *schema.ResourceData) string {
 		d.Get("db_id").(string),
 	}
 
+	if target, ok := getDatabaseTarget(d); ok {
+		ids = append(ids, target.Host, strconv.Itoa(target.Port))
+	}
+
 	return strings.Join(Compact(ids), "-")
 }
 
+// DatabaseTarget is a self-hosted database addressed by host and port.
+type DatabaseTarget struct {
+	Host          string
+	Port          int
+	Engine        string
+	Database      string
+	SslMode       string
+	AdminUsername string
+	AdminKey      string
+}
+
+func getDatabaseTarget(d *schema.ResourceData) (DatabaseTarget, bool) {
+	targets := d.Get("target").([]interface{})
+
+	if len(targets) == 0 || targets[0] == nil {
+		return DatabaseTarget{}, false
+	}
+
+	t := targets[0].(map[string]interface{})
+	target := DatabaseTarget{
+		Host:          t["host"].(string),
+		Port:          t["port"].(int),
+		Engine:        t["engine"].(string),
+		Database:      t["database"].(string),
+		SslMode:       t["sslmode"].(string),
+		AdminUsername: t["admin_username"].(string),
+		AdminKey:      t["admin_key"].(string),
+	}
+
+	if target.Port == 0 {
+		target.Port = 5432
+
+		if target.Engine == DatabaseEngineMysql {
+			target.Port = 3306
+		}
+	}
+
+	if target.Database == "" && target.Engine == DatabaseEnginePostgres {
+		target.Database = "postgres"
+	}
+
+	return target, true
+}
+
+// openDatabaseTarget connects as the admin user with the current password of admin_key, falling back
+// to the previous one while the database has not been rotated yet.
+func openDatabaseTarget(ctx context.Context, secretId string, target DatabaseTarget, session *session.Session) (*sql.DB, error) {
+	var errs []string
+
+	for _, stage := range []string{"AWSCURRENT", "AWSPREVIOUS"} {
+		p, _, err := getPasswordStage(secretId, stage, session)
+
+		if isSecretNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		password, err := p.Get(target.AdminKey)
+
+		if err != nil {
+			continue
+		}
+
+		db, err := openDatabase(ctx, target.Engine, target.Host, target.Port, target.AdminUsername, password, target.Database, target.SslMode)
+
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", stage, err))
+			continue
+		}
+
+		return db, nil
+	}
+
+	return nil, fmt.Errorf("error connecting to %s (%s:%d) with the current or previous %s: %s",
+		target.Engine, target.Host, target.Port, target.AdminKey, strings.Join(errs, "; "))
+}
+
+// updateDatabaseTarget sets the passwords of the db_users with SQL, over a single session so that
+// rotating the admin user does not lock out the rest of the users.
+func updateDatabaseTarget(ctx context.Context, secretId string, target DatabaseTarget, passwords map[string]string, session *session.Session) error {
+	db, err := openDatabaseTarget(ctx, secretId, target, session)
+
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	usernames := make([]string, 0, len(passwords))
+
+	for username := range passwords {
+		usernames = append(usernames, username)
+	}
+
+	sort.Strings(usernames)
+
+	for _, username := range usernames {
+		if err := alterUserPassword(ctx, target.Engine, conn, username, passwords[username]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getTargetPasswords maps the usernames of the db_users to their passwords.
+func getTargetPasswords(dbUsers []DbUser, p Password) (map[string]string, error) {
+	passwords := map[string]string{}
+
+	for _, user := range dbUsers {
+		if user.Username == "" {
+			return nil, fmt.Errorf("db_users (%s) needs a username to be rotated on target", user.Key)
+		}
+
+		password, err := p.Get(user.Key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		passwords[user.Username] = password
+	}
+
+	return passwords, nil
+}
+
 func updateRds(id string, password string, session *session.Session) (bool, error) {
 	rdsClient := rds.New(session)
 
@@ -35,39 +180,78 @@ func updateRds(id string, password string, session *session.Session) (bool, erro
 	return err == nil, err
 }
 
-func updateSdmDatabase(id string, password string, ctx context.Context) (bool, error) {
-	accessKey := os.Getenv("SDM_API_ACCESS_KEY")
-	secretKey := os.Getenv("SDM_API_SECRET_KEY")
-
-	if accessKey == "" || secretKey == "" {
-		return false, nil
-	}
-
-	if client, err := sdm.New(accessKey, secretKey); err != nil {
-		return err == nil, err
+// updateSdmDatabase sets the password of a StrongDM Postgres or MySQL resource, and its username unless empty.
+func updateSdmDatabase(id string, username string, password string, ctx context.Context) (bool, error) {
+	if client, err := getSdmClient(); client == nil {
+		return false, err
 	} else {
 		if r, err := client.Resources().Get(ctx, id); err != nil {
 			return err == nil, err
 		} else {
-			postgres := r.Resource.(*sdm.Postgres)
-			postgres.Password = password
+			switch r.Resource.(type) {
+			case *sdm.Postgres, *sdm.Mysql:
+			default:
+				return false, fmt.Errorf("sdm resource (%s) of type %T is not a Postgres or MySQL resource", id, r.Resource)
+			}
+
+			if err := setSdmPlainCredentials(r.Resource, username, password); err != nil {
+				return false, err
+			}
 
-			_, err := client.Resources().Update(ctx, postgres)
+			_, err := client.Resources().Update(ctx, r.Resource)
 
 			return err == nil, err
 		}
 	}
 }
 
+// DbUser is a database user managed by the association.
+type DbUser struct {
+	Key      string
+	Username string
+	SdmIds   []string
+}
+
+func getDbUsers(dbUsers []interface{}) []DbUser {
+	users := make([]DbUser, 0)
+
+	for _, u := range dbUsers {
+
+		dbUser := u.(map[string]interface{})
+		user := DbUser{
+			Key:      dbUser["key"].(string),
+			Username: dbUser["username"].(string),
+			SdmIds:   make([]string, 0),
+		}
+
+		for _, id := range dbUser["sdm_ids"].([]interface{}) {
+			user.SdmIds = append(user.SdmIds, id.(string))
+		}
+
+		users = append(users, user)
+	}
+
+	return users
+}
+
 func resourceDatabasePasswordAssociation() *schema.Resource {
 	return &schema.Resource{
 		CreateContext: resourceDatabasePasswordAssociationCreate,
 		ReadContext:   resourceDatabasePasswordAssociationRead,
 		UpdateContext: resourceDatabasePasswordAssociationRead,
 		DeleteContext: resourceDatabasePasswordAssociationDelete,
+		CustomizeDiff: resourceDatabasePasswordAssociationCustomizeDiff,
 		Importer: &schema.ResourceImporter{
 			StateContext: schema.ImportStatePassthroughContext,
 		},
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Type:    resourceDatabasePasswordAssociationV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceDatabasePasswordAssociationStateUpgradeV0,
+				Version: 0,
+			},
+		},
 		Schema: map[string]*schema.Schema{
 			"secret_id": {
 				Type:        schema.TypeString,
@@ -75,65 +259,518 @@ func resourceDatabasePasswordAssociation() *schema.Resource {
 				Description: "id of secret",
 			},
 			"db_id": {
-				Type:        schema.TypeString,
-				Optional:    true,
-				Default:     "",
-				Description: "id of rds instance",
+				Type:          schema.TypeString,
+				Optional:      true,
+				Default:       "",
+				ConflictsWith: []string{"target"},
+				Description:   "id of rds instance",
+			},
+			"target": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				MaxItems:      1,
+				ConflictsWith: []string{"db_id"},
+				Description:   "self-hosted database to rotate every db_users entry on with SQL, an alternative to db_id",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"host": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringIsNotEmpty,
+							Description:  "host of the database",
+						},
+						"port": {
+							Type:         schema.TypeInt,
+							Optional:     true,
+							Default:      0,
+							ValidateFunc: validation.IntBetween(0, 65535),
+							Description:  "port of the database, defaults to the port of the engine",
+						},
+						"engine": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      DatabaseEnginePostgres,
+							ValidateFunc: validation.StringInSlice([]string{DatabaseEnginePostgres, DatabaseEngineMysql}, false),
+							Description:  "engine of the database, either postgres or mysql",
+						},
+						"database": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "",
+							Description: "database to connect to, defaults to postgres for the postgres engine",
+						},
+						"sslmode": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      "require",
+							ValidateFunc: validation.StringInSlice([]string{"disable", "require", "verify-ca", "verify-full"}, false),
+							Description:  "ssl mode of the connection, mapped onto the tls option for mysql",
+						},
+						"admin_username": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringIsNotEmpty,
+							Description:  "user to connect as",
+						},
+						"admin_key": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "ADMIN_PASSWORD",
+							Description: "json key of the password to connect with",
+						},
+					},
+				},
+			},
+			"format": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      SecretFormatDefault,
+				ValidateFunc: validation.StringInSlice([]string{SecretFormatDefault, SecretFormatRds}, false),
+				Description:  "layout of the secret, either default or rds",
 			},
 			"db_users": {
 				Type:        schema.TypeList,
-				Description: "Set of maps that define the json key for the password, and sdm resource it is associated with",
+				Description: "database users, each with the json key for the password and the sdm resources it is associated with",
 				Required:    true,
-				Elem: &schema.Schema{
-					Type: schema.TypeMap,
-					Elem: &schema.Schema{
-						Type: schema.TypeString,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"key": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "",
+							Description: "json key of the password, required unless format is rds",
+						},
+						"username": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "",
+							Description: "database user to set on the sdm resources, left unchanged if empty",
+						},
+						"sdm_ids": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Description: "ids of sdm resources",
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validation.StringIsNotEmpty,
+							},
+						},
 					},
 				},
 			},
+			"verify":               verifySchema(),
+			"wait_for_sdm_healthy": waitForSdmHealthySchema(),
+			"sdm_secret_store_id":  sdmSecretStoreIdSchema(),
+			"sdm_resource":         sdmResourceSchema(),
+			"sdm_resource_id":      sdmResourceIdSchema(),
+			"on_destroy":           onDestroySchema(OnDestroyRetain, OnDestroyScramble, OnDestroyRemoveSdmCredentials),
 		},
 		Timeouts: &schema.ResourceTimeout{
 			Default: schema.DefaultTimeout(60 * time.Second),
+			Create:  schema.DefaultTimeout(SdmHealthyTimeout),
 		},
 	}
 }
 
+// resourceDatabasePasswordAssociationCustomizeDiff requires the key of every db_users entry at plan time,
+// unless the secret is in rds format, so a missing key never fails halfway through a rotation.
+func resourceDatabasePasswordAssociationCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if !d.NewValueKnown("format") || d.Get("format").(string) == SecretFormatRds {
+		return nil
+	}
+
+	for i := range d.Get("db_users").([]interface{}) {
+		key := fmt.Sprintf("db_users.%d.key", i)
+
+		if d.NewValueKnown(key) && d.Get(key).(string) == "" {
+			return fmt.Errorf("%s is required unless format is %q", key, SecretFormatRds)
+		}
+	}
+
+	return nil
+}
+
 func resourceDatabasePasswordAssociationCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
-	secretId := getSecretId(d)
-	dbId := d.Get("db_id").(string)
-	dbUsers := d.Get("db_users").([]interface{})
 	session := getSession()
 
-	if p, err := getPassword(secretId, session); err != nil {
+	if _, ok := getDatabaseTarget(d); ok && d.Get("format").(string) == SecretFormatRds {
+		return diag.Errorf("target does not support format %q", SecretFormatRds)
+	}
+
+	// Checked before rotating, so an unsupported engine does not leave a rotated but unmanaged secret
+	sdmResourceType, err := getDatabaseSdmResourceType(d, session)
+
+	if err != nil {
 		return diag.FromErr(err)
+	}
+
+	push := func(p Password) diag.Diagnostics {
+		return pushDatabasePasswords(ctx, d, p, session)
+	}
+
+	probe := func(v Verify, p Password) error {
+		return verifyDatabasePasswords(d, v, p, session)
+	}
+
+	if d.Get("format").(string) == SecretFormatRds {
+		push = func(p Password) diag.Diagnostics {
+			return diag.FromErr(updateRdsFormatUsers(ctx, d, p, session))
+		}
+
+		probe = func(v Verify, p Password) error {
+			return verifyRdsFormatUser(d, v, p, session)
+		}
+	}
+
+	if diags = pushVerified(d, session, push, probe); diags.HasError() {
+		return diags
+	}
+
+	sdmResourceId, err := createDatabaseSdmResource(ctx, d, sdmResourceType, session)
+
+	if err != nil {
+		return append(diags, diag.FromErr(err)...)
+	}
+
+	if sdmResourceId != "" {
+		d.Set("sdm_resource_id", sdmResourceId)
+
+		// Keep the created sdm resource in state even if waiting fails, so it is deleted on replace
+		d.SetId(getDatabasePasswordId(d))
+	}
+
+	sdmIds := append(getDbUsersSdmIds(getDbUsers(d.Get("db_users").([]interface{}))), Compact([]string{sdmResourceId})...)
+
+	if diags = append(diags, waitForSdmHealthy(ctx, d, sdmIds, d.Timeout(schema.TimeoutCreate))...); diags.HasError() {
+		return diags
+	}
+
+	d.SetId(getDatabasePasswordId(d))
+
+	return diags
+}
+
+// getDatabaseSdmResourceType returns the type of the sdm resource of the sdm_resource block, if any, from
+// the engine of the target, of the rds format secret or of the RDS instance, defaulting to Postgres.
+func getDatabaseSdmResourceType(d *schema.ResourceData, session *session.Session) (string, error) {
+	if _, ok := getSdmResource(d); !ok {
+		return "", nil
+	}
+
+	engine := ""
+
+	if target, ok := getDatabaseTarget(d); ok {
+		engine = target.Engine
 	} else {
+		if d.Get("format").(string) == SecretFormatRds {
+			secret, err := getRdsSecret(getSecretId(d), session)
 
-		for _, u := range dbUsers {
+			if err != nil {
+				return "", err
+			}
 
-			dbUser := u.(map[string]interface{})
-			key := dbUser["key"].(string)
-			sdmId := dbUser["sdm_id"].(string)
-			password := p.Get(key)
+			engine = secret.Engine
+		}
 
-			if sdmId != "" {
-				if _, err := updateSdmDatabase(sdmId, password, ctx); err != nil {
-					return diag.FromErr(err)
-				}
+		if dbId := d.Get("db_id").(string); engine == "" && dbId != "" {
+			instance, err := DBInstanceByID(rds.New(session), dbId)
+
+			if err != nil {
+				return "", fmt.Errorf("error reading RDS instance (%s): %w", dbId, err)
 			}
 
-			if dbId != "" && key == "ADMIN_PASSWORD" {
-				if _, err := updateRds(dbId, password, session); err != nil {
-					return diag.FromErr(err)
+			engine = aws.StringValue(instance.Engine)
+		}
+	}
+
+	switch {
+	case engine == "", strings.Contains(engine, "postgres"):
+		return SdmResourceTypePostgres, nil
+	case strings.Contains(engine, "mysql"), strings.Contains(engine, "mariadb"):
+		return SdmResourceTypeMysql, nil
+	}
+
+	return "", fmt.Errorf("sdm_resource does not support engine %q", engine)
+}
+
+// createDatabaseSdmResource creates the Postgres or MySQL sdm resource of the sdm_resource block, if any,
+// for the user in the rds format secret or the first of the db_users.
+func createDatabaseSdmResource(ctx context.Context, d *schema.ResourceData, resourceType string, session *session.Session) (string, error) {
+	if _, ok := getSdmResource(d); !ok {
+		return "", nil
+	}
+
+	if d.Get("format").(string) == SecretFormatRds {
+		secret, err := getRdsSecret(getSecretId(d), session)
+
+		if err != nil {
+			return "", err
+		}
+
+		username := secret.Username
+
+		if d.Get("sdm_secret_store_id").(string) != "" {
+			username = getSdmSecretPath(getSecretId(d), "username")
+		}
+
+		return createSdmResource(ctx, d, resourceType, "password", username, session)
+	}
+
+	key, username := "ADMIN_PASSWORD", ""
+
+	if dbUsers := getDbUsers(d.Get("db_users").([]interface{})); len(dbUsers) > 0 {
+		key, username = dbUsers[0].Key, dbUsers[0].Username
+	}
+
+	return createSdmResource(ctx, d, resourceType, key, username, session)
+}
+
+// pushDatabasePasswords sets the passwords of the db_users on the target or RDS instance and on StrongDM.
+func pushDatabasePasswords(ctx context.Context, d *schema.ResourceData, p Password, session *session.Session) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	secretId := getSecretId(d)
+	dbId := d.Get("db_id").(string)
+	dbUsers := getDbUsers(d.Get("db_users").([]interface{}))
+
+	if target, ok := getDatabaseTarget(d); ok {
+		passwords, err := getTargetPasswords(dbUsers, p)
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if err := updateDatabaseTarget(ctx, secretId, target, passwords, session); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	for _, user := range dbUsers {
+
+		password, err := p.Get(user.Key)
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		for _, sdmId := range user.SdmIds {
+			if _, err := updateSdm(ctx, d, sdmId, user.Key, user.Username, password, updateSdmDatabase); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+
+		if dbId != "" && user.Key == "ADMIN_PASSWORD" {
+			if _, err := updateRds(dbId, password, session); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	return diags
+}
+
+// verifyDatabasePasswords logs in as every db_users entry with a username, on the target or on the
+// RDS instance, where ADMIN_PASSWORD defaults to the master user. RDS engines other than Postgres and
+// MySQL are not verified.
+func verifyDatabasePasswords(d *schema.ResourceData, v Verify, p Password, session *session.Session) error {
+	dbId := d.Get("db_id").(string)
+	dbUsers := getDbUsers(d.Get("db_users").([]interface{}))
+
+	target, ok := getDatabaseTarget(d)
+
+	if !ok && dbId != "" {
+		var err error
+
+		if target, ok, err = getRdsVerifyTarget(dbId, session); err != nil {
+			return err
+		}
+	}
+
+	if !ok {
+		return nil
+	}
+
+	for _, user := range dbUsers {
+
+		username := user.Username
+
+		if username == "" && user.Key == target.AdminKey {
+			username = target.AdminUsername
+		}
+
+		if username == "" {
+			continue
+		}
+
+		password, err := p.Get(user.Key)
+
+		if err != nil {
+			return err
+		}
+
+		name := fmt.Sprintf("%s login of %s at %s:%d", target.Engine, username, target.Host, target.Port)
+
+		err = v.Run(name, func() error {
+			return verifyDatabase(target.Engine, target.Host, target.Port, username, password, target.Database, target.SslMode)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getRdsVerifyTarget returns the endpoint of an RDS instance to verify logins against. It returns
+// false for engines other than Postgres and MySQL, which are not verified.
+func getRdsVerifyTarget(dbId string, session *session.Session) (DatabaseTarget, bool, error) {
+	target := DatabaseTarget{}
+
+	instance, err := DBInstanceByID(rds.New(session), dbId)
+
+	if err != nil {
+		return target, false, fmt.Errorf("error reading RDS instance (%s): %w", dbId, err)
+	}
+
+	engine := aws.StringValue(instance.Engine)
+
+	switch {
+	case strings.Contains(engine, "postgres"):
+		target.Engine = DatabaseEnginePostgres
+		target.Database = "postgres"
+	case strings.Contains(engine, "mysql"), strings.Contains(engine, "mariadb"):
+		target.Engine = DatabaseEngineMysql
+	default:
+		log.Printf("[WARN] not verifying RDS instance (%s) of engine %s", dbId, engine)
+		return target, false, nil
+	}
+
+	if instance.Endpoint == nil {
+		return target, false, fmt.Errorf("RDS instance (%s) has no endpoint", dbId)
+	}
+
+	if instance.DBName != nil {
+		target.Database = aws.StringValue(instance.DBName)
+	}
+
+	target.Host = aws.StringValue(instance.Endpoint.Address)
+	target.Port = int(aws.Int64Value(instance.Endpoint.Port))
+	target.SslMode = "require"
+	target.AdminUsername = aws.StringValue(instance.MasterUsername)
+	target.AdminKey = "ADMIN_PASSWORD"
+
+	return target, true, nil
+}
+
+// verifyRdsFormatUser logs in to the RDS instance as the user of a secret in rds format.
+func verifyRdsFormatUser(d *schema.ResourceData, v Verify, p Password, session *session.Session) error {
+	dbId := d.Get("db_id").(string)
+
+	if dbId == "" {
+		return nil
+	}
+
+	target, ok, err := getRdsVerifyTarget(dbId, session)
+
+	if err != nil || !ok {
+		return err
+	}
+
+	username, err := p.Get("username")
+
+	if err != nil {
+		return err
+	}
+
+	password, err := p.Get("password")
+
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s login of %s at %s:%d", target.Engine, username, target.Host, target.Port)
+
+	return v.Run(name, func() error {
+		return verifyDatabase(target.Engine, target.Host, target.Port, username, password, target.Database, target.SslMode)
+	})
+}
+
+// updateRdsFormatUsers pushes a secret in rds format to its targets. The RDS master password is only
+// changed when the secret holds the master user; other users, including the alternating
+// user/user_clone pair, are rotated by the rotation Lambda and only need StrongDM to follow along.
+func updateRdsFormatUsers(ctx context.Context, d *schema.ResourceData, p Password, session *session.Session) error {
+	secretId := getSecretId(d)
+	dbId := d.Get("db_id").(string)
+	dbUsers := getDbUsers(d.Get("db_users").([]interface{}))
+
+	secret := RdsSecret{Username: p["username"], Password: p["password"]}
+
+	if secret.Username == "" || secret.Password == "" {
+		return fmt.Errorf("secret (%s) is not in rds format: username and password are required", secretId)
+	}
+
+	if dbId != "" {
+		instance, err := DBInstanceByID(rds.New(session), dbId)
+
+		if err != nil {
+			return fmt.Errorf("error reading RDS instance (%s): %w", dbId, err)
+		}
+
+		if aws.StringValue(instance.MasterUsername) == secret.Username {
+			if _, err := updateRds(dbId, secret.Password, session); err != nil {
+				return err
+			}
+		}
+	}
+
+	secretStoreId := d.Get("sdm_secret_store_id").(string)
+
+	for _, user := range dbUsers {
+		for _, sdmId := range user.SdmIds {
+			// The username alternates between user and user_clone, so it is referenced as well
+			if secretStoreId != "" {
+				if _, err := updateSdmSecretStore(sdmId, secretStoreId, getSdmSecretPath(secretId, "username"), getSdmSecretPath(secretId, "password"), ctx); err != nil {
+					return err
 				}
+			} else if _, err := updateSdmDatabase(sdmId, secret.Username, secret.Password, ctx); err != nil {
+				return err
 			}
 		}
 	}
 
-	d.SetId(getDatabasePasswordId(d))
+	return nil
+}
 
-	return diags
+// scrambleRdsFormatMaster sets a random master password if the rds format secret holds the master user.
+func scrambleRdsFormatMaster(dbId string, secretId string, session *session.Session) error {
+	secret, err := getRdsSecret(secretId, session)
+
+	if err != nil {
+		return err
+	}
+
+	instance, err := DBInstanceByID(rds.New(session), dbId)
+
+	if err != nil {
+		return fmt.Errorf("error reading RDS instance (%s): %w", dbId, err)
+	}
+
+	if aws.StringValue(instance.MasterUsername) != secret.Username {
+		return nil
+	}
+
+	password, err := generateRandomPassword(secretsmanager.New(session))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = updateRds(dbId, password, session)
+
+	return err
 }
 
 func resourceDatabasePasswordAssociationRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
@@ -146,5 +783,129 @@ func resourceDatabasePasswordAssociationRead(ctx context.Context, d *schema.Reso
 
 func resourceDatabasePasswordAssociationDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
+
+	dbId := d.Get("db_id").(string)
+	dbUsers := getDbUsers(d.Get("db_users").([]interface{}))
+	session := getSession()
+
+	if err := deleteSdmResource(ctx, d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if getOnDestroy(d) == OnDestroyScramble && dbId != "" && d.Get("format").(string) == SecretFormatRds {
+		if err := scrambleRdsFormatMaster(dbId, getSecretId(d), session); err != nil {
+			return diag.FromErr(err)
+		}
+
+		return diags
+	}
+
+	if target, ok := getDatabaseTarget(d); ok && getOnDestroy(d) == OnDestroyScramble {
+		passwords := map[string]string{}
+
+		for _, user := range dbUsers {
+			if user.Username != "" {
+				password, err := generateRandomPassword(secretsmanager.New(session))
+
+				if err != nil {
+					return diag.FromErr(err)
+				}
+
+				passwords[user.Username] = password
+			}
+		}
+
+		if err := updateDatabaseTarget(ctx, getSecretId(d), target, passwords, session); err != nil {
+			return diag.FromErr(err)
+		}
+
+		return diags
+	}
+
+	for _, user := range dbUsers {
+
+		switch getOnDestroy(d) {
+		case OnDestroyScramble:
+			if dbId != "" && user.Key == "ADMIN_PASSWORD" {
+				password, err := generateRandomPassword(secretsmanager.New(session))
+
+				if err != nil {
+					return diag.FromErr(err)
+				}
+
+				if _, err := updateRds(dbId, password, session); err != nil {
+					return diag.FromErr(err)
+				}
+			}
+		case OnDestroyRemoveSdmCredentials:
+			for _, sdmId := range user.SdmIds {
+				if _, err := updateSdmDatabase(sdmId, "", "", ctx); err != nil {
+					return diag.FromErr(err)
+				}
+			}
+		}
+	}
+
 	return diags
 }
+
+func resourceDatabasePasswordAssociationV0() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"secret_id": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"db_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"format": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"db_users": {
+				Type:     schema.TypeList,
+				Required: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeMap,
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+			},
+			"on_destroy": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+		},
+	}
+}
+
+// resourceDatabasePasswordAssociationStateUpgradeV0 converts the db_users maps to nested blocks.
+func resourceDatabasePasswordAssociationStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	dbUsers, _ := rawState["db_users"].([]interface{})
+	upgraded := make([]interface{}, 0, len(dbUsers))
+
+	for _, u := range dbUsers {
+
+		dbUser, _ := u.(map[string]interface{})
+		key, _ := dbUser["key"].(string)
+		sdmId, _ := dbUser["sdm_id"].(string)
+		sdmIds := make([]interface{}, 0)
+
+		if sdmId != "" {
+			sdmIds = append(sdmIds, sdmId)
+		}
+
+		upgraded = append(upgraded, map[string]interface{}{
+			"key":      key,
+			"username": "",
+			"sdm_ids":  sdmIds,
+		})
+	}
+
+	rawState["db_users"] = upgraded
+
+	return rawState, nil
+}
@@ -0,0 +1,299 @@
+package better
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/docdb"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/hashicorp/aws-sdk-go-base/tfawserr"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	sdm "github.com/strongdm/strongdm-sdk-go"
+)
+
+const (
+	DocDbUpdateTimeout = 30 * time.Minute
+
+	docDbClusterAvailableMinTimeout = 10 * time.Second
+	docDbClusterAvailableDelay      = 30 * time.Second
+
+	DocDbClusterStatusAvailable                  = "available"
+	DocDbClusterStatusBackingUp                  = "backing-up"
+	DocDbClusterStatusModifying                  = "modifying"
+	DocDbClusterStatusResettingMasterCredentials = "resetting-master-credentials"
+	DocDbClusterStatusUpgrading                  = "upgrading"
+)
+
+func getDocDbPasswordId(d *schema.ResourceData) string {
+	ids := []string{
+		getSecretId(d),
+		d.Get("cluster_id").(string),
+	}
+
+	return strings.Join(Compact(ids), "-")
+}
+
+func updateDocDb(id string, password string, session *session.Session) (bool, error) {
+	docDbClient := docdb.New(session)
+
+	_, err := docDbClient.ModifyDBCluster(&docdb.ModifyDBClusterInput{
+		DBClusterIdentifier: aws.String(id),
+		MasterUserPassword:  aws.String(password),
+		ApplyImmediately:    aws.Bool(true),
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("error updating DocumentDB Cluster password (%s): %w", id, err)
+	}
+
+	if _, err := DocDbClusterAvailable(docDbClient, id); err != nil {
+		return false, fmt.Errorf("error waiting for DocumentDB Cluster (%s) update: %w", id, err)
+	}
+
+	return err == nil, err
+}
+
+// DocDbClusterByID retrieves a DocumentDB Cluster by id.
+func DocDbClusterByID(conn *docdb.DocDB, id string) (*docdb.DBCluster, error) {
+	input := &docdb.DescribeDBClustersInput{
+		DBClusterIdentifier: aws.String(id),
+	}
+	output, err := conn.DescribeDBClusters(input)
+	if tfawserr.ErrCodeEquals(err, docdb.ErrCodeDBClusterNotFoundFault) {
+		return nil, &resource.NotFoundError{
+			LastError:   err,
+			LastRequest: input,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if output == nil || len(output.DBClusters) == 0 || output.DBClusters[0] == nil {
+		return nil, &resource.NotFoundError{
+			Message:     "empty result",
+			LastRequest: input,
+		}
+	}
+
+	return output.DBClusters[0], nil
+}
+
+// DocDbClusterStatus fetches the DocumentDB Cluster and its Status
+func DocDbClusterStatus(conn *docdb.DocDB, id string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		cluster, err := DocDbClusterByID(conn, id)
+		if NotFound(err) {
+			return nil, "", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		return cluster, aws.StringValue(cluster.Status), nil
+	}
+}
+
+// DocDbClusterAvailable waits for a DocumentDB Cluster to return Available
+func DocDbClusterAvailable(conn *docdb.DocDB, id string) (*docdb.DBCluster, error) {
+	stateConf := &resource.StateChangeConf{
+		Pending: []string{
+			DocDbClusterStatusBackingUp,
+			DocDbClusterStatusModifying,
+			DocDbClusterStatusResettingMasterCredentials,
+			DocDbClusterStatusUpgrading,
+		},
+		Target:     []string{DocDbClusterStatusAvailable},
+		Refresh:    DocDbClusterStatus(conn, id),
+		Timeout:    DocDbUpdateTimeout,
+		MinTimeout: docDbClusterAvailableMinTimeout,
+		Delay:      docDbClusterAvailableDelay,
+	}
+
+	outputRaw, err := stateConf.WaitForState()
+	if v, ok := outputRaw.(*docdb.DBCluster); ok {
+		return v, err
+	}
+	return nil, err
+}
+
+// updateSdmDocDb sets the password of a StrongDM DocumentDB resource, and its username unless empty.
+// strongdm-sdk-go v0.9.21 has no DocumentDBHost or DocumentDBReplicaSet types, so DocumentDB clusters
+// are expected behind the StrongDM Mongo resource types, which speak the same protocol.
+func updateSdmDocDb(id string, username string, password string, ctx context.Context) (bool, error) {
+	if client, err := getSdmClient(); client == nil {
+		return false, err
+	} else {
+		if r, err := client.Resources().Get(ctx, id); err != nil {
+			return err == nil, err
+		} else {
+			switch r.Resource.(type) {
+			case *sdm.MongoHost, *sdm.MongoReplicaSet, *sdm.MongoLegacyHost, *sdm.MongoLegacyReplicaset:
+			default:
+				return false, fmt.Errorf("sdm resource (%s) of type %T is not a DocumentDB resource", id, r.Resource)
+			}
+
+			if err := setSdmPlainCredentials(r.Resource, username, password); err != nil {
+				return false, err
+			}
+
+			_, err := client.Resources().Update(ctx, r.Resource)
+
+			return err == nil, err
+		}
+	}
+}
+
+func resourceDocDbPasswordAssociation() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceDocDbPasswordAssociationCreate,
+		ReadContext:   resourceDocDbPasswordAssociationRead,
+		UpdateContext: resourceDocDbPasswordAssociationRead,
+		DeleteContext: resourceDocDbPasswordAssociationDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"secret_id": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "id of secret",
+			},
+			"cluster_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "",
+				Description: "id of the DocumentDB cluster",
+			},
+			"db_users": {
+				Type:        schema.TypeList,
+				Description: "database users, each with the json key for the password and the sdm resources it is associated with",
+				Required:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"key": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringIsNotEmpty,
+							Description:  "json key of the password, ADMIN_PASSWORD is set as the cluster master password",
+						},
+						"username": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "",
+							Description: "database user to set on the sdm resources, left unchanged if empty",
+						},
+						"sdm_ids": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Description: "ids of sdm Mongo host or replica set resources, DocumentDB resource types are not supported by the StrongDM SDK in use",
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validation.StringIsNotEmpty,
+							},
+						},
+					},
+				},
+			},
+			"wait_for_sdm_healthy": waitForSdmHealthySchema(),
+			"sdm_secret_store_id":  sdmSecretStoreIdSchema(),
+			"on_destroy":           onDestroySchema(OnDestroyRetain, OnDestroyScramble, OnDestroyRemoveSdmCredentials),
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(60 * time.Second),
+			Create:  schema.DefaultTimeout(SdmHealthyTimeout),
+		},
+	}
+}
+
+func resourceDocDbPasswordAssociationCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	secretId := getSecretId(d)
+	clusterId := d.Get("cluster_id").(string)
+	dbUsers := getDbUsers(d.Get("db_users").([]interface{}))
+	session := getSession()
+
+	if p, err := getPassword(secretId, session); err != nil {
+		return diag.FromErr(err)
+	} else {
+
+		for _, user := range dbUsers {
+
+			password, err := p.Get(user.Key)
+
+			if err != nil {
+				return diag.FromErr(err)
+			}
+
+			if clusterId != "" && user.Key == "ADMIN_PASSWORD" {
+				if _, err := updateDocDb(clusterId, password, session); err != nil {
+					return diag.FromErr(err)
+				}
+			}
+
+			for _, sdmId := range user.SdmIds {
+				if _, err := updateSdm(ctx, d, sdmId, user.Key, user.Username, password, updateSdmDocDb); err != nil {
+					return diag.FromErr(err)
+				}
+			}
+		}
+	}
+
+	if diags = append(diags, waitForSdmHealthy(ctx, d, getDbUsersSdmIds(getDbUsers(d.Get("db_users").([]interface{}))), d.Timeout(schema.TimeoutCreate))...); diags.HasError() {
+		return diags
+	}
+
+	d.SetId(getDocDbPasswordId(d))
+
+	return diags
+}
+
+func resourceDocDbPasswordAssociationRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId(getDocDbPasswordId(d))
+
+	return diags
+}
+
+func resourceDocDbPasswordAssociationDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	clusterId := d.Get("cluster_id").(string)
+	dbUsers := getDbUsers(d.Get("db_users").([]interface{}))
+	session := getSession()
+
+	for _, user := range dbUsers {
+
+		switch getOnDestroy(d) {
+		case OnDestroyScramble:
+			if clusterId != "" && user.Key == "ADMIN_PASSWORD" {
+				password, err := generateRandomPassword(secretsmanager.New(session))
+
+				if err != nil {
+					return diag.FromErr(err)
+				}
+
+				if _, err := updateDocDb(clusterId, password, session); err != nil {
+					return diag.FromErr(err)
+				}
+			}
+		case OnDestroyRemoveSdmCredentials:
+			for _, sdmId := range user.SdmIds {
+				if _, err := updateSdmDocDb(sdmId, "", "", ctx); err != nil {
+					return diag.FromErr(err)
+				}
+			}
+		}
+	}
+
+	return diags
+}
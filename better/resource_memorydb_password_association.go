@@ -0,0 +1,446 @@
+package better
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/memorydb"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/hashicorp/aws-sdk-go-base/tfawserr"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	MemoryDbUpdateTimeout = 30 * time.Minute
+
+	memoryDbActiveMinTimeout = 10 * time.Second
+	memoryDbActiveDelay      = 10 * time.Second
+
+	MemoryDbStatusActive    = "active"
+	MemoryDbStatusModifying = "modifying"
+	MemoryDbStatusCreating  = "creating"
+)
+
+func getMemoryDbPasswordId(d *schema.ResourceData) string {
+	ids := []string{
+		getSecretId(d),
+		strings.Join(getMemoryDbUsernames(getDbUsers(d.Get("memorydb_users").([]interface{}))), "-"),
+	}
+
+	return strings.Join(Compact(ids), "-")
+}
+
+func getMemoryDbUsernames(users []DbUser) []string {
+	usernames := make([]string, 0)
+
+	for _, u := range users {
+		usernames = append(usernames, u.Username)
+	}
+
+	return usernames
+}
+
+// getMemoryDbPasswords returns the new password followed by the previous one of the same key, if any,
+// so clients still holding the previous password keep working until the next rotation. MemoryDB does not
+// return the passwords of a user, so the first rotation, without a previous version of the secret,
+// is a hard cutover from the password the user was created with.
+func getMemoryDbPasswords(password string, previous Password, key string) []string {
+	passwords := []string{password}
+
+	if p, err := previous.Get(key); err == nil && p != "" && p != password {
+		passwords = append(passwords, p)
+	}
+
+	return passwords
+}
+
+func updateMemoryDb(username string, passwords []string, session *session.Session) (bool, error) {
+	memoryDbClient := memorydb.New(session)
+
+	_, err := memoryDbClient.UpdateUser(&memorydb.UpdateUserInput{
+		UserName: aws.String(username),
+		AuthenticationMode: &memorydb.AuthenticationMode{
+			Type:      aws.String(memorydb.InputAuthenticationTypePassword),
+			Passwords: aws.StringSlice(passwords),
+		},
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("error updating MemoryDB User password (%s): %w", username, err)
+	}
+
+	user, err := MemoryDbUserActive(memoryDbClient, username)
+
+	if err != nil {
+		return false, fmt.Errorf("error waiting for MemoryDB User (%s) update: %w", username, err)
+	}
+
+	for _, acl := range user.ACLNames {
+		if _, err := MemoryDbACLActive(memoryDbClient, aws.StringValue(acl)); err != nil {
+			return false, fmt.Errorf("error waiting for MemoryDB ACL (%s) update: %w", aws.StringValue(acl), err)
+		}
+	}
+
+	return err == nil, err
+}
+
+// MemoryDbUserByName retrieves a MemoryDB User by name.
+func MemoryDbUserByName(conn *memorydb.MemoryDB, name string) (*memorydb.User, error) {
+	input := &memorydb.DescribeUsersInput{
+		UserName: aws.String(name),
+	}
+	output, err := conn.DescribeUsers(input)
+	if tfawserr.ErrCodeEquals(err, memorydb.ErrCodeUserNotFoundFault) {
+		return nil, &resource.NotFoundError{
+			LastError:   err,
+			LastRequest: input,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if output == nil || len(output.Users) == 0 || output.Users[0] == nil {
+		return nil, &resource.NotFoundError{
+			Message:     "empty result",
+			LastRequest: input,
+		}
+	}
+
+	return output.Users[0], nil
+}
+
+// MemoryDbUserStatus fetches the MemoryDB User and its Status
+func MemoryDbUserStatus(conn *memorydb.MemoryDB, name string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		user, err := MemoryDbUserByName(conn, name)
+		if NotFound(err) {
+			return nil, "", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		return user, aws.StringValue(user.Status), nil
+	}
+}
+
+// MemoryDbUserActive waits for a MemoryDB User to return Active
+func MemoryDbUserActive(conn *memorydb.MemoryDB, name string) (*memorydb.User, error) {
+	stateConf := &resource.StateChangeConf{
+		Pending:    []string{MemoryDbStatusCreating, MemoryDbStatusModifying},
+		Target:     []string{MemoryDbStatusActive},
+		Refresh:    MemoryDbUserStatus(conn, name),
+		Timeout:    MemoryDbUpdateTimeout,
+		MinTimeout: memoryDbActiveMinTimeout,
+		Delay:      memoryDbActiveDelay,
+	}
+
+	outputRaw, err := stateConf.WaitForState()
+	if v, ok := outputRaw.(*memorydb.User); ok {
+		return v, err
+	}
+	return nil, err
+}
+
+// MemoryDbACLByName retrieves a MemoryDB ACL by name.
+func MemoryDbACLByName(conn *memorydb.MemoryDB, name string) (*memorydb.ACL, error) {
+	input := &memorydb.DescribeACLsInput{
+		ACLName: aws.String(name),
+	}
+	output, err := conn.DescribeACLs(input)
+	if tfawserr.ErrCodeEquals(err, memorydb.ErrCodeACLNotFoundFault) {
+		return nil, &resource.NotFoundError{
+			LastError:   err,
+			LastRequest: input,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if output == nil || len(output.ACLs) == 0 || output.ACLs[0] == nil {
+		return nil, &resource.NotFoundError{
+			Message:     "empty result",
+			LastRequest: input,
+		}
+	}
+
+	return output.ACLs[0], nil
+}
+
+// MemoryDbACLStatus fetches the MemoryDB ACL and its Status
+func MemoryDbACLStatus(conn *memorydb.MemoryDB, name string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		acl, err := MemoryDbACLByName(conn, name)
+		if NotFound(err) {
+			return nil, "", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		return acl, aws.StringValue(acl.Status), nil
+	}
+}
+
+// MemoryDbACLActive waits for a MemoryDB ACL to return Active
+func MemoryDbACLActive(conn *memorydb.MemoryDB, name string) (*memorydb.ACL, error) {
+	stateConf := &resource.StateChangeConf{
+		Pending:    []string{MemoryDbStatusCreating, MemoryDbStatusModifying},
+		Target:     []string{MemoryDbStatusActive},
+		Refresh:    MemoryDbACLStatus(conn, name),
+		Timeout:    MemoryDbUpdateTimeout,
+		MinTimeout: memoryDbActiveMinTimeout,
+		Delay:      memoryDbActiveDelay,
+	}
+
+	outputRaw, err := stateConf.WaitForState()
+	if v, ok := outputRaw.(*memorydb.ACL); ok {
+		return v, err
+	}
+	return nil, err
+}
+
+func resourceMemoryDbPasswordAssociation() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceMemoryDbPasswordAssociationCreate,
+		ReadContext:   resourceMemoryDbPasswordAssociationRead,
+		UpdateContext: resourceMemoryDbPasswordAssociationRead,
+		DeleteContext: resourceMemoryDbPasswordAssociationDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"secret_id": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "id of secret",
+			},
+			"memorydb_users": {
+				Type:        schema.TypeList,
+				Description: "MemoryDB ACL users, each with the json key for the password and the sdm resources it is associated with. The previous password of the key stays valid until the next rotation, except on the first rotation, which replaces the existing passwords",
+				Required:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"key": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringIsNotEmpty,
+							Description:  "json key of the password",
+						},
+						"username": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringIsNotEmpty,
+							Description:  "name of the MemoryDB user",
+						},
+						"sdm_ids": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Description: "ids of sdm resources",
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validation.StringIsNotEmpty,
+							},
+						},
+					},
+				},
+			},
+			"verify":               verifySchema(),
+			"wait_for_sdm_healthy": waitForSdmHealthySchema(),
+			"sdm_secret_store_id":  sdmSecretStoreIdSchema(),
+			"on_destroy":           onDestroySchema(OnDestroyRetain, OnDestroyScramble, OnDestroyRemoveSdmCredentials),
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(60 * time.Second),
+			Create:  schema.DefaultTimeout(SdmHealthyTimeout),
+		},
+	}
+}
+
+func resourceMemoryDbPasswordAssociationCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	memoryDbUsers := getDbUsers(d.Get("memorydb_users").([]interface{}))
+	session := getSession()
+
+	push := func(p Password) diag.Diagnostics {
+		return pushMemoryDbPasswords(ctx, d, p, session)
+	}
+
+	probe := func(v Verify, p Password) error {
+		for _, user := range memoryDbUsers {
+			if err := verifyMemoryDbUser(v, user, p, session); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if diags = pushVerified(d, session, push, probe); diags.HasError() {
+		return diags
+	}
+
+	if diags = append(diags, waitForSdmHealthy(ctx, d, getDbUsersSdmIds(getDbUsers(d.Get("memorydb_users").([]interface{}))), d.Timeout(schema.TimeoutCreate))...); diags.HasError() {
+		return diags
+	}
+
+	d.SetId(getMemoryDbPasswordId(d))
+
+	return diags
+}
+
+// pushMemoryDbPasswords sets the passwords of the memorydb_users, keeping the previous ones, and updates StrongDM.
+func pushMemoryDbPasswords(ctx context.Context, d *schema.ResourceData, p Password, session *session.Session) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	secretId := getSecretId(d)
+	memoryDbUsers := getDbUsers(d.Get("memorydb_users").([]interface{}))
+
+	// There is no previous version before the first rotation
+	previous, _, err := getPasswordStage(secretId, "AWSPREVIOUS", session)
+
+	if isSecretNotFound(err) {
+		previous, err = Password{}, nil
+	}
+
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	for _, user := range memoryDbUsers {
+
+		password, err := p.Get(user.Key)
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		passwords := getMemoryDbPasswords(password, previous, user.Key)
+
+		if len(passwords) == 1 {
+			if u, err := MemoryDbUserByName(memorydb.New(session), user.Username); err == nil && u.Authentication != nil && aws.Int64Value(u.Authentication.PasswordCount) > 0 {
+				diags = append(diags, diag.Diagnostic{
+					Severity: diag.Warning,
+					Summary:  fmt.Sprintf("MemoryDB User (%s) passwords replaced", user.Username),
+					Detail:   fmt.Sprintf("The secret has no previous %s to keep, so clients using the existing passwords of the user are cut off.", user.Key),
+				})
+			}
+		}
+
+		if _, err := updateMemoryDb(user.Username, passwords, session); err != nil {
+			return diag.FromErr(err)
+		}
+
+		for _, sdmId := range user.SdmIds {
+			if _, err := updateSdm(ctx, d, sdmId, user.Key, "", password, updateSdmRedisUser); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	return diags
+}
+
+// verifyMemoryDbUser authenticates as the user on the endpoint of every cluster its ACLs are attached to.
+func verifyMemoryDbUser(v Verify, user DbUser, p Password, session *session.Session) error {
+	memoryDbClient := memorydb.New(session)
+
+	password, err := p.Get(user.Key)
+
+	if err != nil {
+		return err
+	}
+
+	u, err := MemoryDbUserByName(memoryDbClient, user.Username)
+
+	if err != nil {
+		return fmt.Errorf("error reading MemoryDB User (%s): %w", user.Username, err)
+	}
+
+	for _, aclName := range u.ACLNames {
+		acl, err := MemoryDbACLByName(memoryDbClient, aws.StringValue(aclName))
+
+		if err != nil {
+			return fmt.Errorf("error reading MemoryDB ACL (%s): %w", aws.StringValue(aclName), err)
+		}
+
+		for _, clusterName := range acl.Clusters {
+			output, err := memoryDbClient.DescribeClusters(&memorydb.DescribeClustersInput{
+				ClusterName: clusterName,
+			})
+
+			if err != nil {
+				return fmt.Errorf("error reading MemoryDB Cluster (%s): %w", aws.StringValue(clusterName), err)
+			}
+
+			for _, cluster := range output.Clusters {
+				if cluster.ClusterEndpoint == nil {
+					continue
+				}
+
+				host := aws.StringValue(cluster.ClusterEndpoint.Address)
+				port := int(aws.Int64Value(cluster.ClusterEndpoint.Port))
+
+				err := v.Run(fmt.Sprintf("MemoryDB login of %s at %s:%d", user.Username, host, port), func() error {
+					return verifyRedisAuth(host, port, aws.BoolValue(cluster.TLSEnabled), user.Username, password)
+				})
+
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func resourceMemoryDbPasswordAssociationRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId(getMemoryDbPasswordId(d))
+
+	return diags
+}
+
+func resourceMemoryDbPasswordAssociationDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	memoryDbUsers := getDbUsers(d.Get("memorydb_users").([]interface{}))
+	session := getSession()
+
+	for _, user := range memoryDbUsers {
+
+		switch getOnDestroy(d) {
+		case OnDestroyScramble:
+			password, err := generateRandomPassword(secretsmanager.New(session))
+
+			if err != nil {
+				return diag.FromErr(err)
+			}
+
+			// A single password drops the one kept from the previous rotation as well
+			if _, err := updateMemoryDb(user.Username, []string{password}, session); err != nil {
+				return diag.FromErr(err)
+			}
+		case OnDestroyRemoveSdmCredentials:
+			for _, sdmId := range user.SdmIds {
+				if _, err := updateSdmRedis(sdmId, "", ctx); err != nil {
+					return diag.FromErr(err)
+				}
+			}
+		}
+	}
+
+	return diags
+}
@@ -2,15 +2,15 @@ package better
 
 import (
 	"context"
-	"encoding/json"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
+var mqPasswordDefaultKeys = []string{"ADMIN_PASSWORD", "USER_PASSWORD"}
+
 func resourceMqPassword() *schema.Resource {
 	return &schema.Resource{
 		CreateContext: resourceMqPasswordCreate,
@@ -26,6 +26,9 @@ func resourceMqPassword() *schema.Resource {
 				Required:    true,
 				Description: "id of secret",
 			},
+			"include_punctuation": includePunctuationSchema(),
+			"keys":                keysSchema(),
+			"on_destroy":          onDestroySchema(OnDestroyRetain, OnDestroyClearSecret),
 		},
 		Timeouts: &schema.ResourceTimeout{
 			Default: schema.DefaultTimeout(60 * time.Second),
@@ -38,12 +41,8 @@ func resourceMqPasswordCreate(ctx context.Context, d *schema.ResourceData, m int
 
 	secretsManager := secretsmanager.New(getSession())
 
-	secret := Password{
-		AdminPassword: generateRandomPassword(secretsManager),
-		UserPassword:  generateRandomPassword(secretsManager),
-	}
-
-	secretString, err := json.Marshal(secret)
+	keys := getKeys(d, mqPasswordDefaultKeys)
+	secret, err := generatePassword(secretsManager, keys, d.Get("include_punctuation").(bool))
 
 	if err != nil {
 		return diag.FromErr(err)
@@ -51,14 +50,11 @@ func resourceMqPasswordCreate(ctx context.Context, d *schema.ResourceData, m int
 
 	secretId := getSecretId(d)
 
-	psvi := &secretsmanager.PutSecretValueInput{
-		SecretId:     aws.String(secretId),
-		SecretString: aws.String(string(secretString)),
+	if err := writePassword(secretsManager, secretId, secret); err != nil {
+		return diag.FromErr(err)
 	}
 
-	_, err = secretsManager.PutSecretValue(psvi)
-
-	if err != nil {
+	if err := d.Set("keys", keys); err != nil {
 		return diag.FromErr(err)
 	}
 
@@ -77,5 +73,12 @@ func resourceMqPasswordRead(ctx context.Context, d *schema.ResourceData, m inter
 
 func resourceMqPasswordDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
+
+	if getOnDestroy(d) == OnDestroyClearSecret {
+		if err := clearSecret(getSecretId(d), getKeys(d, mqPasswordDefaultKeys), getSession()); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
 	return diags
 }
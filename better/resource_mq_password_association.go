@@ -3,7 +3,8 @@ package better
 import (
 	"context"
 	"fmt"
-	"os"
+	"log"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -11,40 +12,241 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/mq"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
 	"github.com/hashicorp/aws-sdk-go-base/tfawserr"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	sdm "github.com/strongdm/strongdm-sdk-go"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 const (
 	BrokerRebootTimeout = 30 * time.Minute
+
+	// Amazon MQ maintenance windows last up to two hours
+	brokerMaintenanceWindowDuration = 2 * time.Hour
+	userChangesAppliedMinTimeout    = 1 * time.Minute
+
+	RebootPolicyImmediate         = "immediate"
+	RebootPolicyNone              = "none"
+	RebootPolicyMaintenanceWindow = "maintenance_window"
+
+	UserChangesStatusPending = "pending"
+	UserChangesStatusApplied = "applied"
 )
 
 func getMqPasswordId(d *schema.ResourceData) string {
 	ids := []string{
 		getSecretId(d),
 		d.Get("mq_id").(string),
-		d.Get("sdm_id").(string),
 	}
 
 	return strings.Join(Compact(ids), "-")
 }
 
-func updateMq(id string, user string, password string, consoleAccess bool, session *session.Session) (bool, error) {
+// MqUser is a broker user managed by the association.
+type MqUser struct {
+	Username      string
+	Key           string
+	ConsoleAccess bool
+	Groups        []string
+	SdmIds        []string
+}
+
+func getMqUsers(mqUsers []interface{}) []MqUser {
+	users := make([]MqUser, 0)
+
+	for _, u := range mqUsers {
+
+		mqUser := u.(map[string]interface{})
+		user := MqUser{
+			Username:      mqUser["username"].(string),
+			Key:           mqUser["key"].(string),
+			ConsoleAccess: mqUser["console_access"].(bool),
+		}
+
+		// An empty list leaves the groups of the user alone
+		for _, g := range mqUser["groups"].([]interface{}) {
+			user.Groups = append(user.Groups, g.(string))
+		}
+
+		for _, id := range mqUser["sdm_ids"].([]interface{}) {
+			user.SdmIds = append(user.SdmIds, id.(string))
+		}
+
+		users = append(users, user)
+	}
+
+	return users
+}
+
+func getMqUsernames(users []MqUser) []string {
+	usernames := make([]string, 0)
+
+	for _, u := range users {
+		usernames = append(usernames, u.Username)
+	}
+
+	return usernames
+}
+
+func updateMq(id string, user MqUser, password string, session *session.Session) (bool, error) {
 	mqClient := mq.New(session)
 
-	_, err := mqClient.UpdateUser(&mq.UpdateUserRequest{
+	input := &mq.UpdateUserRequest{
 		BrokerId:      aws.String(id),
-		Username:      aws.String(user),
-		ConsoleAccess: aws.Bool(consoleAccess),
+		Username:      aws.String(user.Username),
+		ConsoleAccess: aws.Bool(user.ConsoleAccess),
 		Password:      aws.String(password),
+	}
+
+	// Leave the groups of the user alone unless they are managed
+	if user.Groups != nil {
+		input.Groups = aws.StringSlice(user.Groups)
+	}
+
+	_, err := mqClient.UpdateUser(input)
+
+	return err == nil, err
+}
+
+func createMq(id string, user MqUser, password string, session *session.Session) (bool, error) {
+	mqClient := mq.New(session)
+
+	input := &mq.CreateUserRequest{
+		BrokerId:      aws.String(id),
+		Username:      aws.String(user.Username),
+		ConsoleAccess: aws.Bool(user.ConsoleAccess),
+		Password:      aws.String(password),
+	}
+
+	if user.Groups != nil {
+		input.Groups = aws.StringSlice(user.Groups)
+	}
+
+	_, err := mqClient.CreateUser(input)
+
+	if err != nil {
+		return false, fmt.Errorf("error creating MQ Broker (%s) user (%s): %w", id, user.Username, err)
+	}
+
+	return err == nil, err
+}
+
+func deleteMq(id string, user string, session *session.Session) (bool, error) {
+	mqClient := mq.New(session)
+
+	_, err := mqClient.DeleteUser(&mq.DeleteUserInput{
+		BrokerId: aws.String(id),
+		Username: aws.String(user),
 	})
 
+	if tfawserr.ErrCodeEquals(err, mq.ErrCodeNotFoundException) {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error deleting MQ Broker (%s) user (%s): %w", id, user, err)
+	}
+
 	return err == nil, err
 }
 
+// listMqUsers returns the usernames of an ActiveMQ broker, including users pending creation.
+func listMqUsers(id string, session *session.Session) (map[string]bool, error) {
+	mqClient := mq.New(session)
+	users := map[string]bool{}
+	input := &mq.ListUsersInput{
+		BrokerId: aws.String(id),
+	}
+
+	for {
+		output, err := mqClient.ListUsers(input)
+
+		if err != nil {
+			return nil, fmt.Errorf("error listing MQ Broker (%s) users: %w", id, err)
+		}
+
+		for _, u := range output.Users {
+			users[aws.StringValue(u.Username)] = true
+		}
+
+		if aws.StringValue(output.NextToken) == "" {
+			return users, nil
+		}
+
+		input.NextToken = output.NextToken
+	}
+}
+
+// getMqManagement returns a RabbitMQ management API client when mq_id is a RabbitMQ broker, or when
+// only management_url is set, and nil for ActiveMQ brokers, which are updated through the MQ API instead.
+func getMqManagement(d *schema.ResourceData, session *session.Session) (*RabbitMqManagement, error) {
+	mqId := d.Get("mq_id").(string)
+
+	if mqId == "" {
+		if d.Get("management_url").(string) == "" {
+			return nil, nil
+		}
+
+		return getRabbitMqManagement(d, nil, session)
+	}
+
+	broker, err := describeBroker(mqId, session)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if aws.StringValue(broker.EngineType) != mq.EngineTypeRabbitmq {
+		return nil, nil
+	}
+
+	return getRabbitMqManagement(d, broker, session)
+}
+
+// updateMqUser sets the password of a broker user, through the management API for RabbitMQ
+// brokers and the MQ API for ActiveMQ brokers. ActiveMQ users missing from existing are created.
+func updateMqUser(rabbitMq *RabbitMqManagement, mqId string, user MqUser, password string, existing map[string]bool, session *session.Session) error {
+	if rabbitMq == nil {
+		if !existing[user.Username] {
+			_, err := createMq(mqId, user, password, session)
+
+			return err
+		}
+
+		_, err := updateMq(mqId, user, password, session)
+
+		return err
+	}
+
+	if err := rabbitMq.UpdatePassword(user.Username, password); err != nil {
+		return fmt.Errorf("error updating RabbitMQ user (%s) on MQ Broker (%s): %w", user.Username, mqId, err)
+	}
+
+	// Keep authenticating once the admin password itself has changed
+	if user.Username == rabbitMq.Username {
+		rabbitMq.Password = password
+	}
+
+	return nil
+}
+
+// deleteMqUser removes a broker user, through the management API for RabbitMQ brokers and the MQ API for ActiveMQ brokers.
+func deleteMqUser(rabbitMq *RabbitMqManagement, mqId string, user string, session *session.Session) error {
+	if rabbitMq == nil {
+		_, err := deleteMq(mqId, user, session)
+
+		return err
+	}
+
+	if err := rabbitMq.DeleteUser(user); err != nil {
+		return fmt.Errorf("error deleting RabbitMQ user (%s) on MQ Broker (%s): %w", user, mqId, err)
+	}
+
+	return nil
+}
+
 func rebootMq(mqId string, session *session.Session) (bool, error) {
 	mqClient := mq.New(session)
 
@@ -62,6 +264,75 @@ func rebootMq(mqId string, session *session.Session) (bool, error) {
 	return err == nil, err
 }
 
+func describeBroker(id string, session *session.Session) (*mq.DescribeBrokerResponse, error) {
+	mqClient := mq.New(session)
+
+	output, err := mqClient.DescribeBroker(&mq.DescribeBrokerInput{
+		BrokerId: aws.String(id),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("error describing MQ Broker (%s): %w", id, err)
+	}
+
+	return output, nil
+}
+
+// getRabbitMqManagement returns a management API client for a RabbitMQ broker authenticated as the
+// admin user. The current admin password of the secret is tried first and the previous one second,
+// since the secret may already hold a password that has not reached the broker yet. The bootstrap
+// password, if any, is tried last, for brokers still using the password they were created with.
+func getRabbitMqManagement(d *schema.ResourceData, broker *mq.DescribeBrokerResponse, session *session.Session) (*RabbitMqManagement, error) {
+	secretId := getSecretId(d)
+	adminUser := d.Get("admin_user").(string)
+	adminKey := d.Get("admin_key").(string)
+	endpoint := d.Get("management_url").(string)
+
+	if endpoint == "" {
+		if broker == nil {
+			return nil, fmt.Errorf("management_url is required without mq_id")
+		}
+
+		if len(broker.BrokerInstances) == 0 || broker.BrokerInstances[0] == nil {
+			return nil, fmt.Errorf("MQ Broker (%s) has no instances", aws.StringValue(broker.BrokerId))
+		}
+
+		endpoint = aws.StringValue(broker.BrokerInstances[0].ConsoleURL)
+	}
+
+	passwords := make([]string, 0)
+
+	for _, stage := range []string{"AWSCURRENT", "AWSPREVIOUS"} {
+		p, _, err := getPasswordStage(secretId, stage, session)
+
+		if isSecretNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if password, err := p.Get(adminKey); err == nil {
+			passwords = append(passwords, password)
+		}
+	}
+
+	if bootstrapPassword := d.Get("bootstrap_password").(string); bootstrapPassword != "" {
+		passwords = append(passwords, bootstrapPassword)
+	}
+
+	for _, password := range passwords {
+		management := newRabbitMqManagement(endpoint, adminUser, password)
+
+		if ok, err := management.Authenticated(); err != nil {
+			return nil, err
+		} else if ok {
+			return management, nil
+		}
+	}
+
+	return nil, fmt.Errorf("error authenticating to RabbitMQ management API (%s) as %s with the current or previous %s, or the bootstrap_password", endpoint, adminUser, adminKey)
+}
+
 func BrokerStatus(conn *mq.MQ, id string) resource.StateRefreshFunc {
 	return func() (interface{}, string, error) {
 		output, err := conn.DescribeBroker(&mq.DescribeBrokerInput{
@@ -102,25 +373,179 @@ func BrokerRebooted(conn *mq.MQ, id string) (*mq.DescribeBrokerResponse, error)
 	return nil, err
 }
 
-func updateSdmMq(id string, user string, password string, ctx context.Context) (bool, error) {
-	accessKey := os.Getenv("SDM_API_ACCESS_KEY")
-	secretKey := os.Getenv("SDM_API_SECRET_KEY")
+// pendingMqUsers returns the users that have changes waiting for the next broker reboot. Users
+// that do not exist, like deleted users that were never created, have nothing pending.
+func pendingMqUsers(conn *mq.MQ, id string, users []string) ([]string, error) {
+	pending := make([]string, 0)
+
+	for _, user := range users {
+		output, err := conn.DescribeUser(&mq.DescribeUserInput{
+			BrokerId: aws.String(id),
+			Username: aws.String(user),
+		})
+
+		if tfawserr.ErrCodeEquals(err, mq.ErrCodeNotFoundException) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error describing MQ Broker (%s) user (%s): %w", id, user, err)
+		}
 
-	if accessKey == "" || secretKey == "" {
-		return false, nil
+		if output.Pending != nil {
+			pending = append(pending, user)
+		}
 	}
 
-	if client, err := sdm.New(accessKey, secretKey); err != nil {
-		return err == nil, err
+	return pending, nil
+}
+
+// UserChangesStatus reports whether any of the users still have pending changes
+func UserChangesStatus(conn *mq.MQ, id string, users []string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		pending, err := pendingMqUsers(conn, id, users)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		if len(pending) > 0 {
+			return pending, UserChangesStatusPending, nil
+		}
+
+		return pending, UserChangesStatusApplied, nil
+	}
+}
+
+// UserChangesApplied waits for the pending changes of the users to be applied by a broker reboot
+func UserChangesApplied(ctx context.Context, conn *mq.MQ, id string, users []string, timeout time.Duration) error {
+	stateConf := resource.StateChangeConf{
+		Pending:    []string{UserChangesStatusPending},
+		Target:     []string{UserChangesStatusApplied},
+		Timeout:    timeout,
+		MinTimeout: userChangesAppliedMinTimeout,
+		Refresh:    UserChangesStatus(conn, id, users),
+	}
+
+	_, err := stateConf.WaitForStateContext(ctx)
+
+	return err
+}
+
+// nextMaintenanceWindow returns the start of the broker maintenance window in progress at now, if any,
+// and otherwise the start of the next one. A window in progress may have started the day before.
+func nextMaintenanceWindow(w *mq.WeeklyStartTime, now time.Time) (time.Time, error) {
+	if w == nil {
+		return time.Time{}, fmt.Errorf("broker has no maintenance window")
+	}
+
+	location := time.UTC
+
+	if tz := aws.StringValue(w.TimeZone); tz != "" {
+		l, err := time.LoadLocation(tz)
+
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error parsing maintenance window time zone (%s): %w", tz, err)
+		}
+
+		location = l
+	}
+
+	clock, err := time.Parse("15:04", aws.StringValue(w.TimeOfDay))
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error parsing maintenance window time of day (%s): %w", aws.StringValue(w.TimeOfDay), err)
+	}
+
+	now = now.In(location)
+
+	for i := -1; i <= 7; i++ {
+		day := now.AddDate(0, 0, i)
+		start := time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, location)
+
+		if strings.EqualFold(start.Weekday().String(), aws.StringValue(w.DayOfWeek)) && start.Add(brokerMaintenanceWindowDuration).After(now) {
+			return start, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid maintenance window day of week (%s)", aws.StringValue(w.DayOfWeek))
+}
+
+// applyMqChanges applies pending ActiveMQ user changes according to the reboot policy. With the
+// maintenance_window policy it waits for the window, failing early when the window starts after the
+// deadline of ctx, which is the timeout of the resource operation.
+func applyMqChanges(ctx context.Context, mqId string, users []string, policy string, session *session.Session) (diag.Diagnostics, error) {
+	var diags diag.Diagnostics
+
+	if policy == RebootPolicyImmediate {
+		_, err := rebootMq(mqId, session)
+
+		return diags, err
+	}
+
+	mqClient := mq.New(session)
+
+	pending, err := pendingMqUsers(mqClient, mqId, users)
+
+	if err != nil || len(pending) == 0 {
+		return diags, err
+	}
+
+	if policy == RebootPolicyNone {
+		return append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("MQ Broker (%s) has pending user changes", mqId),
+			Detail:   fmt.Sprintf("Users %s are updated on the next broker reboot.", strings.Join(pending, ", ")),
+		}), nil
+	}
+
+	broker, err := describeBroker(mqId, session)
+
+	if err != nil {
+		return diags, err
+	}
+
+	start, err := nextMaintenanceWindow(broker.MaintenanceWindowStartTime, time.Now())
+
+	if err != nil {
+		return diags, fmt.Errorf("error reading MQ Broker (%s) maintenance window: %w", mqId, err)
+	}
+
+	diags = append(diags, diag.Diagnostic{
+		Severity: diag.Warning,
+		Summary:  fmt.Sprintf("MQ Broker (%s) has pending user changes", mqId),
+		Detail:   fmt.Sprintf("Users %s are updated in the maintenance window starting %s.", strings.Join(pending, ", "), start.Format(time.RFC3339)),
+	})
+
+	if deadline, ok := ctx.Deadline(); ok && start.After(deadline) {
+		return diags, fmt.Errorf("MQ Broker (%s) maintenance window starts %s, after the operation times out at %s: raise the timeouts of the association or use reboot_policy %q",
+			mqId, start.Format(time.RFC3339), deadline.Format(time.RFC3339), RebootPolicyNone)
+	}
+
+	// For a window in progress this is the remainder of the window
+	timeout := time.Until(start) + brokerMaintenanceWindowDuration + BrokerRebootTimeout
+
+	if err := UserChangesApplied(ctx, mqClient, mqId, pending, timeout); err != nil {
+		return diags, fmt.Errorf("error waiting for MQ Broker (%s) user changes: %w", mqId, err)
+	}
+
+	return diags, nil
+}
+
+// updateSdmMq sets the credentials of the StrongDM resource exposing a broker user, such as the
+// HTTP basic auth resource of the web console.
+func updateSdmMq(id string, user string, password string, ctx context.Context) (bool, error) {
+	if client, err := getSdmClient(); client == nil {
+		return false, err
 	} else {
 		if r, err := client.Resources().Get(ctx, id); err != nil {
 			return err == nil, err
 		} else {
-			website := r.Resource.(*sdm.HTTPBasicAuth)
-			website.Username = user
-			website.Password = password
+			if err := setSdmPlainCredentials(r.Resource, user, password); err != nil {
+				return false, err
+			}
 
-			_, err := client.Resources().Update(ctx, website)
+			_, err := client.Resources().Update(ctx, r.Resource)
 
 			return err == nil, err
 		}
@@ -131,10 +556,23 @@ func resourceMqPasswordAssociation() *schema.Resource {
 	return &schema.Resource{
 		CreateContext: resourceMqPasswordAssociationCreate,
 		ReadContext:   resourceMqPasswordAssociationRead,
-		UpdateContext: resourceMqPasswordAssociationRead,
+		UpdateContext: resourceMqPasswordAssociationUpdate,
 		DeleteContext: resourceMqPasswordAssociationDelete,
 		Importer: &schema.ResourceImporter{
-			StateContext: schema.ImportStatePassthroughContext,
+			StateContext: resourceMqPasswordAssociationImport,
+		},
+		SchemaVersion: 2,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Type:    resourceMqPasswordAssociationV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceMqPasswordAssociationStateUpgradeV0,
+				Version: 0,
+			},
+			{
+				Type:    resourceMqPasswordAssociationV1().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceMqPasswordAssociationStateUpgradeV1,
+				Version: 1,
+			},
 		},
 		Schema: map[string]*schema.Schema{
 			"secret_id": {
@@ -150,76 +588,384 @@ func resourceMqPasswordAssociation() *schema.Resource {
 			},
 			"mq_users": {
 				Type:        schema.TypeList,
-				Description: "Set of maps that define username, console access, and the json key for the password",
+				Description: "broker users, each with console access, groups, and the json key for the password",
 				Required:    true,
-				Elem: &schema.Schema{
-					Type: schema.TypeMap,
-					Elem: &schema.Schema{
-						Type: schema.TypeString,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"username": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringIsNotEmpty,
+							Description:  "name of the broker user",
+						},
+						"key": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringIsNotEmpty,
+							Description:  "json key of the password",
+						},
+						"console_access": {
+							Type:        schema.TypeBool,
+							Optional:    true,
+							Default:     false,
+							Description: "whether the user can access the ActiveMQ web console",
+						},
+						"groups": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Description: "ActiveMQ groups of the user, left unchanged if empty",
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validation.StringIsNotEmpty,
+							},
+						},
+						"sdm_ids": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Description: "ids of sdm resources that expose the user",
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validation.StringIsNotEmpty,
+							},
+						},
 					},
 				},
 			},
-			"sdm_id": {
+			"admin_user": {
 				Type:        schema.TypeString,
 				Optional:    true,
+				Default:     "admin",
+				Description: "RabbitMQ user used to authenticate to the management API",
+			},
+			"admin_key": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "ADMIN_PASSWORD",
+				Description: "json key of the password of admin_user",
+			},
+			"management_url": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "",
+				Description: "RabbitMQ management API url, defaults to the console url of the broker. Without mq_id, the users are rotated on the RabbitMQ server behind it",
+			},
+			"bootstrap_password": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
 				Default:     "",
-				Description: "id of sdm resource",
+				Description: "password admin_user was created with, tried when neither the current nor the previous admin_key authenticates",
 			},
+			"reboot_policy": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      RebootPolicyImmediate,
+				ValidateFunc: validation.StringInSlice([]string{RebootPolicyImmediate, RebootPolicyNone, RebootPolicyMaintenanceWindow}, false),
+				Description:  "when ActiveMQ user changes are applied: immediate reboot, none, or the broker's maintenance_window, which is waited for and needs create and update timeouts reaching past the window",
+			},
+			"delete_removed_users": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "delete users from the broker when they are removed from mq_users",
+			},
+			"verify":               verifySchema(),
+			"wait_for_sdm_healthy": waitForSdmHealthySchema(),
+			"sdm_secret_store_id":  sdmSecretStoreIdSchema(),
+			"on_destroy":           onDestroySchema(OnDestroyRetain, OnDestroyScramble, OnDestroyRemoveSdmCredentials),
 		},
 		Timeouts: &schema.ResourceTimeout{
 			Default: schema.DefaultTimeout(60 * time.Second),
+			Create:  schema.DefaultTimeout(SdmHealthyTimeout),
+			Update:  schema.DefaultTimeout(SdmHealthyTimeout),
 		},
 	}
 }
 
 func resourceMqPasswordAssociationCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	diags := pushVerifiedMqUsers(ctx, d, nil, d.Timeout(schema.TimeoutCreate))
+
+	if diags.HasError() {
+		return diags
+	}
+
+	d.SetId(getMqPasswordId(d))
+
+	return diags
+}
+
+func resourceMqPasswordAssociationUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	// Only user changes touch the broker, so other settings never cause a reboot
+	if !d.HasChanges("mq_users", "secret_id") {
+		return resourceMqPasswordAssociationRead(ctx, d, m)
+	}
+
+	removed := make([]string, 0)
+
+	if d.Get("delete_removed_users").(bool) && d.HasChange("mq_users") {
+		o, n := d.GetChange("mq_users")
+		current := map[string]bool{}
+
+		for _, u := range getMqUsernames(getMqUsers(n.([]interface{}))) {
+			current[u] = true
+		}
+
+		for _, u := range getMqUsernames(getMqUsers(o.([]interface{}))) {
+			if !current[u] {
+				removed = append(removed, u)
+			}
+		}
+	}
+
+	diags := pushVerifiedMqUsers(ctx, d, removed, d.Timeout(schema.TimeoutUpdate))
+
+	if diags.HasError() {
+		return diags
+	}
+
+	return append(diags, resourceMqPasswordAssociationRead(ctx, d, m)...)
+}
+
+// pushVerifiedMqUsers syncs the users with the broker, verifies them when the association has a verify
+// block and waits for their sdm resources when wait_for_sdm_healthy is set.
+func pushVerifiedMqUsers(ctx context.Context, d *schema.ResourceData, removed []string, timeout time.Duration) diag.Diagnostics {
+	session := getSession()
+
+	push := func(p Password) diag.Diagnostics {
+		diags := syncMqUsers(ctx, d, p, removed)
+
+		// Removed users are deleted once, not again when rolling back
+		removed = nil
+
+		return diags
+	}
+
+	probe := func(v Verify, p Password) error {
+		return verifyMqUsers(d, v, p, session)
+	}
+
+	diags := pushVerified(d, session, push, probe)
+
+	if diags.HasError() {
+		return diags
+	}
+
+	var sdmIds []string
+
+	for _, user := range getMqUsers(d.Get("mq_users").([]interface{})) {
+		sdmIds = append(sdmIds, user.SdmIds...)
+	}
+
+	return append(diags, waitForSdmHealthy(ctx, d, sdmIds, timeout)...)
+}
+
+// verifyMqUsers logs in as the broker users, over STOMP for ActiveMQ and through the management API
+// for RabbitMQ, where only the admin user and users with console access can log in. ActiveMQ users are
+// only verified with the immediate reboot policy, as other policies leave the changes pending.
+func verifyMqUsers(d *schema.ResourceData, v Verify, p Password, session *session.Session) error {
+	mqId := d.Get("mq_id").(string)
+	mqUsers := getMqUsers(d.Get("mq_users").([]interface{}))
+
+	var broker *mq.DescribeBrokerResponse
+	var err error
+
+	if mqId != "" {
+		if broker, err = describeBroker(mqId, session); err != nil {
+			return err
+		}
+	} else if d.Get("management_url").(string) == "" {
+		return nil
+	}
+
+	isRabbitMq := broker == nil || aws.StringValue(broker.EngineType) == mq.EngineTypeRabbitmq
+
+	var probe func(user string, password string) error
+	var endpoint string
+
+	if isRabbitMq {
+		rabbitMq, err := getRabbitMqManagement(d, broker, session)
+
+		if err != nil {
+			return err
+		}
+
+		endpoint = rabbitMq.Endpoint
+		probe = func(user string, password string) error {
+			if ok, err := newRabbitMqManagement(endpoint, user, password).Authenticated(); err != nil {
+				return err
+			} else if !ok {
+				return fmt.Errorf("RabbitMQ management API (%s) rejected %s", endpoint, user)
+			}
+
+			return nil
+		}
+	} else {
+		if d.Get("reboot_policy").(string) != RebootPolicyImmediate {
+			log.Printf("[WARN] not verifying MQ Broker (%s) users, their changes are pending a reboot", mqId)
+			return nil
+		}
+
+		if len(broker.BrokerInstances) == 0 || broker.BrokerInstances[0] == nil {
+			return fmt.Errorf("MQ Broker (%s) has no instances", mqId)
+		}
+
+		for _, e := range broker.BrokerInstances[0].Endpoints {
+			if u, err := url.Parse(aws.StringValue(e)); err == nil && u.Scheme == "stomp+ssl" {
+				endpoint = u.Host
+			}
+		}
+
+		if endpoint == "" {
+			return fmt.Errorf("MQ Broker (%s) has no stomp+ssl endpoint", mqId)
+		}
+
+		probe = func(user string, password string) error {
+			return verifyStomp(endpoint, true, user, password)
+		}
+	}
+
+	for _, user := range mqUsers {
+
+		if isRabbitMq && !user.ConsoleAccess && user.Username != d.Get("admin_user").(string) {
+			continue
+		}
+
+		password, err := p.Get(user.Key)
+
+		if err != nil {
+			return err
+		}
+
+		username := user.Username
+
+		err = v.Run(fmt.Sprintf("MQ login of %s at %s", username, endpoint), func() error {
+			return probe(username, password)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncMqUsers pushes the passwords of mq_users to the broker, creating missing users and deleting removed ones.
+func syncMqUsers(ctx context.Context, d *schema.ResourceData, p Password, removed []string) diag.Diagnostics {
 	var diags diag.Diagnostics
 
-	secretId := getSecretId(d)
 	mqId := d.Get("mq_id").(string)
-	sdmId := d.Get("sdm_id").(string)
-	mqUsers := d.Get("mq_users").([]interface{})
+	mqUsers := getMqUsers(d.Get("mq_users").([]interface{}))
 	session := getSession()
 
-	if p, err := getPassword(secretId, session); err != nil {
+	if mqId == "" && d.Get("management_url").(string) == "" {
+		return diags
+	}
+
+	rabbitMq, err := getMqManagement(d, session)
+
+	if err != nil {
 		return diag.FromErr(err)
-	} else {
+	}
 
-		for _, u := range mqUsers {
+	existing := map[string]bool{}
 
-			mqUser := u.(map[string]interface{})
-			user := mqUser["user"].(string)
-			consoleAccess, _ := strconv.ParseBool(mqUser["console_access"].(string))
-			key := mqUser["key"].(string)
-			password := p.Get(key)
+	if rabbitMq == nil {
+		if existing, err = listMqUsers(mqId, session); err != nil {
+			return diag.FromErr(err)
+		}
+	}
 
-			if mqId != "" && user != "" {
-				if _, err := updateMq(mqId, user, password, consoleAccess, session); err != nil {
-					return diag.FromErr(err)
-				}
+	for _, user := range mqUsers {
 
-				// Only update SDM for the admin user
-				if sdmId != "" && user == "admin" && consoleAccess {
-					if _, err := updateSdmMq(sdmId, user, password, ctx); err != nil {
-						return diag.FromErr(err)
-					}
-				}
-			}
+		password, err := p.Get(user.Key)
+
+		if err != nil {
+			return diag.FromErr(err)
 		}
 
-		// Reboot MQ broker to apply the changes
-		if mqId != "" {
-			if _, err := rebootMq(mqId, session); err != nil {
+		if err := updateMqUser(rabbitMq, mqId, user, password, existing, session); err != nil {
+			return diag.FromErr(err)
+		}
+
+		for _, sdmId := range user.SdmIds {
+			if _, err := updateSdm(ctx, d, sdmId, user.Key, user.Username, password, updateSdmMq); err != nil {
 				return diag.FromErr(err)
 			}
 		}
 	}
 
-	d.SetId(getMqPasswordId(d))
+	for _, user := range removed {
+		if err := deleteMqUser(rabbitMq, mqId, user, session); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// ActiveMQ applies user changes on reboot, RabbitMQ applies them immediately
+	if rabbitMq == nil {
+		rebootDiags, err := applyMqChanges(ctx, mqId, append(getMqUsernames(mqUsers), removed...), d.Get("reboot_policy").(string), session)
+		diags = append(diags, rebootDiags...)
+
+		if err != nil {
+			return append(diags, diag.FromErr(err)...)
+		}
+	}
 
 	return diags
 }
 
+// resourceMqPasswordAssociationImport adopts the users of an ActiveMQ broker, imported as <mq_id>/<secret_id>.
+// The json keys of the imported users are left empty and need to be set in the configuration.
+func resourceMqPasswordAssociationImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	parts := strings.SplitN(d.Id(), "/", 2)
+
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("unexpected format of ID (%s), expected <mq_id>/<secret_id>", d.Id())
+	}
+
+	mqId := parts[0]
+	session := getSession()
+	mqClient := mq.New(session)
+
+	existing, err := listMqUsers(mqId, session)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mqUsers := make([]interface{}, 0)
+
+	for _, user := range getSortedKeys(existing) {
+		output, err := mqClient.DescribeUser(&mq.DescribeUserInput{
+			BrokerId: aws.String(mqId),
+			Username: aws.String(user),
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("error describing MQ Broker (%s) user (%s): %w", mqId, user, err)
+		}
+
+		mqUsers = append(mqUsers, map[string]interface{}{
+			"username":       user,
+			"key":            "",
+			"console_access": aws.BoolValue(output.ConsoleAccess),
+			"groups":         aws.StringValueSlice(output.Groups),
+			"sdm_ids":        []string{},
+		})
+	}
+
+	d.Set("mq_id", mqId)
+	d.Set("secret_id", parts[1])
+
+	if err := d.Set("mq_users", mqUsers); err != nil {
+		return nil, err
+	}
+
+	d.SetId(getMqPasswordId(d))
+
+	return []*schema.ResourceData{d}, nil
+}
+
 func resourceMqPasswordAssociationRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
 
@@ -230,5 +976,220 @@ func resourceMqPasswordAssociationRead(ctx context.Context, d *schema.ResourceDa
 
 func resourceMqPasswordAssociationDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	var diags diag.Diagnostics
+
+	mqId := d.Get("mq_id").(string)
+	mqUsers := getMqUsers(d.Get("mq_users").([]interface{}))
+	session := getSession()
+
+	switch getOnDestroy(d) {
+	case OnDestroyScramble:
+		if mqId == "" && d.Get("management_url").(string) == "" {
+			break
+		}
+
+		rabbitMq, err := getMqManagement(d, session)
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		existing := map[string]bool{}
+
+		if rabbitMq == nil {
+			if existing, err = listMqUsers(mqId, session); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+
+		for _, user := range mqUsers {
+
+			password, err := generateRandomPassword(secretsmanager.New(session))
+
+			if err != nil {
+				return diag.FromErr(err)
+			}
+
+			// Never create users just to scramble them
+			if rabbitMq == nil && !existing[user.Username] {
+				continue
+			}
+
+			if err := updateMqUser(rabbitMq, mqId, user, password, existing, session); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+
+		if rabbitMq == nil {
+			rebootDiags, err := applyMqChanges(ctx, mqId, getMqUsernames(mqUsers), d.Get("reboot_policy").(string), session)
+			diags = append(diags, rebootDiags...)
+
+			if err != nil {
+				return append(diags, diag.FromErr(err)...)
+			}
+		}
+	case OnDestroyRemoveSdmCredentials:
+		for _, user := range mqUsers {
+			for _, sdmId := range user.SdmIds {
+				if _, err := updateSdmMq(sdmId, user.Username, "", ctx); err != nil {
+					return diag.FromErr(err)
+				}
+			}
+		}
+	}
+
 	return diags
 }
+
+func resourceMqPasswordAssociationV0() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"secret_id": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"mq_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"mq_users": {
+				Type:     schema.TypeList,
+				Required: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeMap,
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+			},
+			"sdm_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"admin_user": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"admin_key": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"management_url": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"reboot_policy": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"delete_removed_users": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"on_destroy": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+		},
+	}
+}
+
+// resourceMqPasswordAssociationStateUpgradeV0 converts the mq_users maps to nested blocks.
+func resourceMqPasswordAssociationStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	mqUsers, _ := rawState["mq_users"].([]interface{})
+	upgraded := make([]interface{}, 0, len(mqUsers))
+
+	for _, u := range mqUsers {
+
+		mqUser, _ := u.(map[string]interface{})
+		user, _ := mqUser["user"].(string)
+		key, _ := mqUser["key"].(string)
+		consoleAccess := false
+		groups := make([]interface{}, 0)
+
+		if v, ok := mqUser["console_access"].(string); ok && v != "" {
+			b, err := strconv.ParseBool(v)
+
+			if err != nil {
+				return nil, fmt.Errorf("error parsing console_access of mq user (%s): %w", user, err)
+			}
+
+			consoleAccess = b
+		}
+
+		if v, ok := mqUser["groups"].(string); ok {
+			for _, g := range Compact(strings.Split(v, ",")) {
+				groups = append(groups, g)
+			}
+		}
+
+		upgraded = append(upgraded, map[string]interface{}{
+			"username":       user,
+			"key":            key,
+			"console_access": consoleAccess,
+			"groups":         groups,
+		})
+	}
+
+	rawState["mq_users"] = upgraded
+
+	return rawState, nil
+}
+
+func resourceMqPasswordAssociationV1() *schema.Resource {
+	v1 := resourceMqPasswordAssociationV0()
+
+	v1.Schema["mq_users"] = &schema.Schema{
+		Type:     schema.TypeList,
+		Required: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"username": {
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				"key": {
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				"console_access": {
+					Type:     schema.TypeBool,
+					Optional: true,
+				},
+				"groups": {
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+			},
+		},
+	}
+
+	return v1
+}
+
+// resourceMqPasswordAssociationStateUpgradeV1 moves the top level sdm_id to the sdm_ids of the
+// users it used to be updated for, the admin user with console access.
+func resourceMqPasswordAssociationStateUpgradeV1(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	sdmId, _ := rawState["sdm_id"].(string)
+	mqUsers, _ := rawState["mq_users"].([]interface{})
+
+	for _, u := range mqUsers {
+
+		mqUser, _ := u.(map[string]interface{})
+		user, _ := mqUser["username"].(string)
+		consoleAccess, _ := mqUser["console_access"].(bool)
+		sdmIds := make([]interface{}, 0)
+
+		if sdmId != "" && user == "admin" && consoleAccess {
+			sdmIds = append(sdmIds, sdmId)
+		}
+
+		mqUser["sdm_ids"] = sdmIds
+	}
+
+	delete(rawState, "sdm_id")
+
+	return rawState, nil
+}
@@ -0,0 +1,235 @@
+package better
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kafka"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/hashicorp/aws-sdk-go-base/tfawserr"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	MskScramSecretPrefix = "AmazonMSK_"
+)
+
+var mskScramPasswordKeys = []string{"password"}
+
+func getMskScramPasswordId(d *schema.ResourceData) string {
+	ids := []string{
+		getSecretId(d),
+		d.Get("cluster_arn").(string),
+	}
+
+	return strings.Join(Compact(ids), "-")
+}
+
+// getMskScramSecretArn returns the arn of the secret after checking the requirements MSK has
+// for SCRAM secrets: a name starting with AmazonMSK_ and a customer managed KMS key.
+func getMskScramSecretArn(secretId string, session *session.Session) (string, error) {
+	secretsManager := secretsmanager.New(session)
+
+	output, err := secretsManager.DescribeSecret(&secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(secretId),
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("error describing secret (%s): %w", secretId, err)
+	}
+
+	if !strings.HasPrefix(aws.StringValue(output.Name), MskScramSecretPrefix) {
+		return "", fmt.Errorf("secret (%s) name must start with %s to be used for MSK SCRAM", secretId, MskScramSecretPrefix)
+	}
+
+	kmsKeyId := aws.StringValue(output.KmsKeyId)
+
+	if kmsKeyId == "" {
+		return "", fmt.Errorf("secret (%s) must be encrypted with a customer managed KMS key to be used for MSK SCRAM", secretId)
+	}
+
+	// The key may be named by alias, key id or arn, so only KMS knows whether it is AWS managed
+	key, err := kms.New(session).DescribeKey(&kms.DescribeKeyInput{
+		KeyId: aws.String(kmsKeyId),
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("error describing KMS key (%s) of secret (%s): %w", kmsKeyId, secretId, err)
+	}
+
+	if key.KeyMetadata == nil || aws.StringValue(key.KeyMetadata.KeyManager) == kms.KeyManagerTypeAws {
+		return "", fmt.Errorf("secret (%s) must be encrypted with a customer managed KMS key to be used for MSK SCRAM", secretId)
+	}
+
+	return aws.StringValue(output.ARN), nil
+}
+
+// unprocessedScramSecretsError reports the secrets MSK failed to associate or disassociate.
+func unprocessedScramSecretsError(clusterArn string, unprocessed []*kafka.UnprocessedScramSecret) error {
+	if len(unprocessed) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(unprocessed))
+
+	for _, u := range unprocessed {
+		messages = append(messages, fmt.Sprintf("%s: %s (%s)", aws.StringValue(u.SecretArn), aws.StringValue(u.ErrorMessage), aws.StringValue(u.ErrorCode)))
+	}
+
+	return fmt.Errorf("MSK Cluster (%s) did not process SCRAM secrets: %s", clusterArn, strings.Join(messages, "; "))
+}
+
+func associateMskScramSecret(clusterArn string, secretArn string, session *session.Session) (bool, error) {
+	kafkaClient := kafka.New(session)
+
+	output, err := kafkaClient.BatchAssociateScramSecret(&kafka.BatchAssociateScramSecretInput{
+		ClusterArn:    aws.String(clusterArn),
+		SecretArnList: aws.StringSlice([]string{secretArn}),
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("error associating SCRAM secret with MSK Cluster (%s): %w", clusterArn, err)
+	}
+
+	if err := unprocessedScramSecretsError(clusterArn, output.UnprocessedScramSecrets); err != nil {
+		return false, err
+	}
+
+	return err == nil, err
+}
+
+func disassociateMskScramSecret(clusterArn string, secretArn string, session *session.Session) (bool, error) {
+	kafkaClient := kafka.New(session)
+
+	output, err := kafkaClient.BatchDisassociateScramSecret(&kafka.BatchDisassociateScramSecretInput{
+		ClusterArn:    aws.String(clusterArn),
+		SecretArnList: aws.StringSlice([]string{secretArn}),
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("error disassociating SCRAM secret from MSK Cluster (%s): %w", clusterArn, err)
+	}
+
+	if err := unprocessedScramSecretsError(clusterArn, output.UnprocessedScramSecrets); err != nil {
+		return false, err
+	}
+
+	return err == nil, err
+}
+
+func resourceMskScramPassword() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceMskScramPasswordCreate,
+		ReadContext:   resourceMskScramPasswordRead,
+		UpdateContext: resourceMskScramPasswordRead,
+		DeleteContext: resourceMskScramPasswordDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"secret_id": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "id of secret, its name must start with AmazonMSK_ and it must use a customer managed KMS key",
+			},
+			"username": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringIsNotEmpty,
+				Description:  "SASL/SCRAM username",
+			},
+			"cluster_arn": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Default:     "",
+				Description: "arn of the MSK cluster to associate the secret with",
+			},
+			"on_destroy": onDestroySchema(OnDestroyRetain, OnDestroyClearSecret),
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(60 * time.Second),
+		},
+	}
+}
+
+func resourceMskScramPasswordCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	session := getSession()
+	secretsManager := secretsmanager.New(session)
+	secretId := getSecretId(d)
+	clusterArn := d.Get("cluster_arn").(string)
+
+	secretArn, err := getMskScramSecretArn(secretId, session)
+
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	secret, err := generatePassword(secretsManager, mskScramPasswordKeys, false)
+
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	secret["username"] = d.Get("username").(string)
+
+	if err := writePassword(secretsManager, secretId, secret); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if clusterArn != "" {
+		if _, err := associateMskScramSecret(clusterArn, secretArn, session); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	d.SetId(getMskScramPasswordId(d))
+
+	return diags
+}
+
+func resourceMskScramPasswordRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId(getMskScramPasswordId(d))
+
+	return diags
+}
+
+func resourceMskScramPasswordDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	session := getSession()
+	secretId := getSecretId(d)
+	clusterArn := d.Get("cluster_arn").(string)
+
+	if clusterArn != "" {
+		secretArn, err := getMskScramSecretArn(secretId, session)
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if _, err := disassociateMskScramSecret(clusterArn, secretArn, session); err != nil && !tfawserr.ErrCodeEquals(err, kafka.ErrCodeNotFoundException) {
+			return diag.FromErr(err)
+		}
+	}
+
+	if getOnDestroy(d) == OnDestroyClearSecret {
+		if err := clearSecret(secretId, []string{"username", "password"}, session); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	return diags
+}
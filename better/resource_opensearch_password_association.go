@@ -0,0 +1,348 @@
+package better
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/opensearchservice"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/hashicorp/aws-sdk-go-base/tfawserr"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	sdm "github.com/strongdm/strongdm-sdk-go"
+)
+
+const (
+	DomainUpdateTimeout = 60 * time.Minute
+
+	domainProcessedMinTimeout = 10 * time.Second
+	domainProcessedDelay      = 30 * time.Second
+
+	DomainStatusProcessing = "processing"
+	DomainStatusActive     = "active"
+)
+
+func getOpenSearchPasswordId(d *schema.ResourceData) string {
+	ids := []string{
+		getSecretId(d),
+		d.Get("domain_name").(string),
+	}
+
+	return strings.Join(Compact(ids), "-")
+}
+
+func updateOpenSearch(domainName string, user string, password string, session *session.Session) (bool, error) {
+	openSearchClient := opensearchservice.New(session)
+
+	_, err := openSearchClient.UpdateDomainConfig(&opensearchservice.UpdateDomainConfigInput{
+		DomainName: aws.String(domainName),
+		AdvancedSecurityOptions: &opensearchservice.AdvancedSecurityOptionsInput_{
+			MasterUserOptions: &opensearchservice.MasterUserOptions{
+				MasterUserName:     aws.String(user),
+				MasterUserPassword: aws.String(password),
+			},
+		},
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("error updating OpenSearch Domain master user password (%s): %w", domainName, err)
+	}
+
+	if _, err := DomainProcessed(openSearchClient, domainName); err != nil {
+		return false, fmt.Errorf("error waiting for OpenSearch Domain (%s) update: %w", domainName, err)
+	}
+
+	return err == nil, err
+}
+
+func DomainStatus(conn *opensearchservice.OpenSearchService, domainName string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		output, err := conn.DescribeDomain(&opensearchservice.DescribeDomainInput{
+			DomainName: aws.String(domainName),
+		})
+
+		if tfawserr.ErrCodeEquals(err, opensearchservice.ErrCodeResourceNotFoundException) {
+			return nil, "", nil
+		}
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		if output == nil || output.DomainStatus == nil {
+			return nil, "", nil
+		}
+
+		if aws.BoolValue(output.DomainStatus.Processing) {
+			return output.DomainStatus, DomainStatusProcessing, nil
+		}
+
+		return output.DomainStatus, DomainStatusActive, nil
+	}
+}
+
+func DomainProcessed(conn *opensearchservice.OpenSearchService, domainName string) (*opensearchservice.DomainStatus, error) {
+	stateConf := resource.StateChangeConf{
+		Pending: []string{
+			DomainStatusProcessing,
+		},
+		Target:     []string{DomainStatusActive},
+		Timeout:    DomainUpdateTimeout,
+		MinTimeout: domainProcessedMinTimeout,
+		Delay:      domainProcessedDelay,
+		Refresh:    DomainStatus(conn, domainName),
+	}
+	outputRaw, err := stateConf.WaitForState()
+
+	if output, ok := outputRaw.(*opensearchservice.DomainStatus); ok {
+		return output, err
+	}
+
+	return nil, err
+}
+
+// updateSdmOpenSearch sets the credentials of a StrongDM HTTP basic auth or Elastic resource in front of the domain.
+func updateSdmOpenSearch(id string, user string, password string, ctx context.Context) (bool, error) {
+	if client, err := getSdmClient(); client == nil {
+		return false, err
+	} else {
+		if r, err := client.Resources().Get(ctx, id); err != nil {
+			return err == nil, err
+		} else {
+			switch r.Resource.(type) {
+			case *sdm.HTTPBasicAuth, *sdm.Elastic:
+			default:
+				return false, fmt.Errorf("sdm resource (%s) of type %T is not an HTTP basic auth or Elastic resource", id, r.Resource)
+			}
+
+			if err := setSdmPlainCredentials(r.Resource, user, password); err != nil {
+				return false, err
+			}
+
+			_, err := client.Resources().Update(ctx, r.Resource)
+
+			return err == nil, err
+		}
+	}
+}
+
+func resourceOpenSearchPasswordAssociation() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceOpenSearchPasswordAssociationCreate,
+		ReadContext:   resourceOpenSearchPasswordAssociationRead,
+		UpdateContext: resourceOpenSearchPasswordAssociationRead,
+		DeleteContext: resourceOpenSearchPasswordAssociationDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"secret_id": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "id of secret",
+			},
+			"domain_name": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "",
+				Description: "name of the OpenSearch domain",
+			},
+			"master_user": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.StringIsNotEmpty,
+				Description:  "name of the fine-grained access control master user",
+			},
+			"key": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "ADMIN_PASSWORD",
+				Description: "json key of the master user password",
+			},
+			"sdm_ids": {
+				Type:        schema.TypeList,
+				Optional:    true,
+				Description: "ids of sdm HTTP basic auth or Elastic resources",
+				Elem: &schema.Schema{
+					Type:         schema.TypeString,
+					ValidateFunc: validation.StringIsNotEmpty,
+				},
+			},
+			"verify":               verifySchema(),
+			"wait_for_sdm_healthy": waitForSdmHealthySchema(),
+			"sdm_secret_store_id":  sdmSecretStoreIdSchema(),
+			"sdm_resource":         sdmResourceSchema(),
+			"sdm_resource_id":      sdmResourceIdSchema(),
+			"on_destroy":           onDestroySchema(OnDestroyRetain, OnDestroyScramble, OnDestroyRemoveSdmCredentials),
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(60 * time.Second),
+			Create:  schema.DefaultTimeout(SdmHealthyTimeout),
+		},
+	}
+}
+
+func getSdmIds(d *schema.ResourceData) []string {
+	ids := make([]string, 0)
+
+	for _, id := range d.Get("sdm_ids").([]interface{}) {
+		ids = append(ids, id.(string))
+	}
+
+	return ids
+}
+
+func resourceOpenSearchPasswordAssociationCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	session := getSession()
+
+	push := func(p Password) diag.Diagnostics {
+		return pushOpenSearchPassword(ctx, d, p, session)
+	}
+
+	probe := func(v Verify, p Password) error {
+		password, err := p.Get(d.Get("key").(string))
+
+		if err != nil {
+			return err
+		}
+
+		return verifyOpenSearchPassword(d, v, password, session)
+	}
+
+	if diags = pushVerified(d, session, push, probe); diags.HasError() {
+		return diags
+	}
+
+	sdmResourceId, err := createSdmResource(ctx, d, SdmResourceTypeHttpBasicAuth, d.Get("key").(string), d.Get("master_user").(string), session)
+
+	if err != nil {
+		return append(diags, diag.FromErr(err)...)
+	}
+
+	if sdmResourceId != "" {
+		d.Set("sdm_resource_id", sdmResourceId)
+
+		// Keep the created sdm resource in state even if waiting fails, so it is deleted on replace
+		d.SetId(getOpenSearchPasswordId(d))
+	}
+
+	if diags = append(diags, waitForSdmHealthy(ctx, d, append(getSdmIds(d), Compact([]string{sdmResourceId})...), d.Timeout(schema.TimeoutCreate))...); diags.HasError() {
+		return diags
+	}
+
+	d.SetId(getOpenSearchPasswordId(d))
+
+	return diags
+}
+
+// pushOpenSearchPassword sets the master user password on the domain and on StrongDM.
+func pushOpenSearchPassword(ctx context.Context, d *schema.ResourceData, p Password, session *session.Session) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	domainName := d.Get("domain_name").(string)
+	user := d.Get("master_user").(string)
+
+	if password, err := p.Get(d.Get("key").(string)); err != nil {
+		return diag.FromErr(err)
+	} else {
+
+		if domainName != "" {
+			if _, err := updateOpenSearch(domainName, user, password, session); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+
+		for _, sdmId := range getSdmIds(d) {
+			if _, err := updateSdm(ctx, d, sdmId, d.Get("key").(string), user, password, updateSdmOpenSearch); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	return diags
+}
+
+// verifyOpenSearchPassword probes the domain endpoint with HTTP basic auth as the master user.
+func verifyOpenSearchPassword(d *schema.ResourceData, v Verify, password string, session *session.Session) error {
+	domainName := d.Get("domain_name").(string)
+	user := d.Get("master_user").(string)
+
+	if domainName == "" {
+		return nil
+	}
+
+	output, err := opensearchservice.New(session).DescribeDomain(&opensearchservice.DescribeDomainInput{
+		DomainName: aws.String(domainName),
+	})
+
+	if err != nil {
+		return fmt.Errorf("error reading OpenSearch Domain (%s): %w", domainName, err)
+	}
+
+	endpoint := aws.StringValue(output.DomainStatus.Endpoint)
+
+	if endpoint == "" {
+		endpoint = aws.StringValue(output.DomainStatus.Endpoints["vpc"])
+	}
+
+	if endpoint == "" {
+		return fmt.Errorf("OpenSearch Domain (%s) has no endpoint", domainName)
+	}
+
+	url := "https://" + endpoint + "/"
+
+	return v.Run(fmt.Sprintf("HTTP basic auth of %s at %s", user, url), func() error {
+		return verifyHttpBasicAuth(url, user, password)
+	})
+}
+
+func resourceOpenSearchPasswordAssociationRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId(getOpenSearchPasswordId(d))
+
+	return diags
+}
+
+func resourceOpenSearchPasswordAssociationDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	domainName := d.Get("domain_name").(string)
+	user := d.Get("master_user").(string)
+	session := getSession()
+
+	if err := deleteSdmResource(ctx, d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	switch getOnDestroy(d) {
+	case OnDestroyScramble:
+		if domainName != "" {
+			password, err := generateComplexPassword(secretsmanager.New(session))
+
+			if err != nil {
+				return diag.FromErr(err)
+			}
+
+			if _, err := updateOpenSearch(domainName, user, password, session); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	case OnDestroyRemoveSdmCredentials:
+		for _, sdmId := range getSdmIds(d) {
+			if _, err := updateSdmOpenSearch(sdmId, "", "", ctx); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	return diags
+}
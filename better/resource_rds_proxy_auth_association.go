@@ -0,0 +1,613 @@
+package better
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/hashicorp/aws-sdk-go-base/tfawserr"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	RdsProxyUpdateTimeout  = 10 * time.Minute
+	RdsProxyTargetsTimeout = 10 * time.Minute
+
+	rdsProxyAvailableMinTimeout = 10 * time.Second
+	rdsProxyAvailableDelay      = 10 * time.Second
+
+	// RdsProxyTargetsStatusPending is reported while any target of the proxy is not available.
+	RdsProxyTargetsStatusPending   = "pending"
+	RdsProxyTargetsStatusAvailable = "available"
+)
+
+func getRdsProxyAuthId(d *schema.ResourceData) string {
+	ids := []string{
+		getSecretId(d),
+		d.Get("proxy_name").(string),
+	}
+
+	return strings.Join(Compact(ids), "-")
+}
+
+// RdsProxyUser is a database user the proxy authenticates with its own secret.
+type RdsProxyUser struct {
+	Key      string
+	Username string
+	SecretId string
+	IAMAuth  string
+}
+
+func getRdsProxyUsers(proxyUsers []interface{}) []RdsProxyUser {
+	users := make([]RdsProxyUser, 0)
+
+	for _, u := range proxyUsers {
+
+		proxyUser := u.(map[string]interface{})
+		users = append(users, RdsProxyUser{
+			Key:      proxyUser["key"].(string),
+			Username: proxyUser["username"].(string),
+			SecretId: proxyUser["secret_id"].(string),
+			IAMAuth:  proxyUser["iam_auth"].(string),
+		})
+	}
+
+	return users
+}
+
+// writeRdsProxySecret writes the {username,password} secret read by the proxy, unless it is already in sync.
+func writeRdsProxySecret(svc *secretsmanager.SecretsManager, user RdsProxyUser, password string) error {
+	document, _, err := getSecretDocument(svc, user.SecretId)
+
+	if isSecretNotFound(err) {
+		document, err = map[string]interface{}{}, nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if document["username"] == user.Username && document["password"] == password {
+		return nil
+	}
+
+	return writePassword(svc, user.SecretId, Password{
+		"username": user.Username,
+		"password": password,
+	})
+}
+
+func getSecretArn(svc *secretsmanager.SecretsManager, secretId string) (string, error) {
+	output, err := svc.DescribeSecret(&secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(secretId),
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("error reading secret (%s): %w", secretId, err)
+	}
+
+	return aws.StringValue(output.ARN), nil
+}
+
+// getRdsProxySecretArns returns the ARNs of the secrets of the users, skipping secrets that no longer exist.
+func getRdsProxySecretArns(svc *secretsmanager.SecretsManager, users []RdsProxyUser) ([]string, error) {
+	arns := make([]string, 0)
+
+	for _, user := range users {
+		arn, err := getSecretArn(svc, user.SecretId)
+
+		if isSecretNotFound(err) {
+			log.Printf("[WARN] secret (%s) of RDS Proxy user %s not found", user.SecretId, user.Username)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		arns = append(arns, arn)
+	}
+
+	return arns, nil
+}
+
+// updateRdsProxyAuth registers the secrets of the users with the proxy and deregisters the removed
+// secret ARNs, keeping the other auth entries. Entries already registered for a user keep their
+// settings, apart from the ones managed by the association.
+func updateRdsProxyAuth(name string, users []RdsProxyUser, secretArns map[string]string, removed []string, timeout time.Duration, session *session.Session) (bool, error) {
+	rdsClient := rds.New(session)
+
+	proxy, err := DBProxyByName(rdsClient, name)
+
+	if err != nil {
+		return false, fmt.Errorf("error reading RDS Proxy (%s): %w", name, err)
+	}
+
+	wanted := map[string]RdsProxyUser{}
+	existing := map[string]*rds.UserAuthConfigInfo{}
+	stale := map[string]bool{}
+
+	for _, user := range users {
+		wanted[secretArns[user.SecretId]] = user
+	}
+
+	for _, arn := range removed {
+		stale[arn] = true
+	}
+
+	auth := make([]*rds.UserAuthConfig, 0)
+	changed := false
+
+	for _, a := range proxy.Auth {
+		secretArn := aws.StringValue(a.SecretArn)
+
+		if user, ok := wanted[secretArn]; ok {
+			if aws.StringValue(a.IAMAuth) != user.IAMAuth || aws.StringValue(a.AuthScheme) != rds.AuthSchemeSecrets {
+				changed = true
+			}
+
+			existing[secretArn] = a
+			delete(wanted, secretArn)
+			continue
+		}
+
+		if stale[secretArn] {
+			changed = true
+			continue
+		}
+
+		auth = append(auth, &rds.UserAuthConfig{
+			AuthScheme:             a.AuthScheme,
+			ClientPasswordAuthType: a.ClientPasswordAuthType,
+			Description:            a.Description,
+			IAMAuth:                a.IAMAuth,
+			SecretArn:              a.SecretArn,
+			UserName:               a.UserName,
+		})
+	}
+
+	if len(wanted) > 0 {
+		changed = true
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	if len(auth) == 0 && len(users) == 0 {
+		return false, &RdsProxyNoAuthError{Name: name}
+	}
+
+	for _, user := range users {
+		secretArn := secretArns[user.SecretId]
+		config := &rds.UserAuthConfig{
+			Description: aws.String(fmt.Sprintf("%s, managed by terraform-provider-better", user.Username)),
+		}
+
+		if a, ok := existing[secretArn]; ok {
+			config = &rds.UserAuthConfig{
+				AuthScheme:             a.AuthScheme,
+				ClientPasswordAuthType: a.ClientPasswordAuthType,
+				Description:            a.Description,
+				IAMAuth:                a.IAMAuth,
+				SecretArn:              a.SecretArn,
+				UserName:               a.UserName,
+			}
+		}
+
+		config.AuthScheme = aws.String(rds.AuthSchemeSecrets)
+		config.IAMAuth = aws.String(user.IAMAuth)
+		config.SecretArn = aws.String(secretArn)
+
+		auth = append(auth, config)
+	}
+
+	_, err = rdsClient.ModifyDBProxy(&rds.ModifyDBProxyInput{
+		DBProxyName: aws.String(name),
+		Auth:        auth,
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("error updating RDS Proxy (%s) auth: %w", name, err)
+	}
+
+	if _, err := DBProxyAvailable(rdsClient, name, timeout); err != nil {
+		return false, fmt.Errorf("error waiting for RDS Proxy (%s) update: %w", name, err)
+	}
+
+	return true, nil
+}
+
+// RdsProxyNoAuthError is returned when deregistering would leave a proxy without any auth entry,
+// which RDS does not allow.
+type RdsProxyNoAuthError struct {
+	Name string
+}
+
+func (e *RdsProxyNoAuthError) Error() string {
+	return fmt.Sprintf("RDS Proxy (%s) needs at least one auth entry", e.Name)
+}
+
+// DBProxyByName retrieves an RDS Proxy by name.
+func DBProxyByName(conn *rds.RDS, name string) (*rds.DBProxy, error) {
+	input := &rds.DescribeDBProxiesInput{
+		DBProxyName: aws.String(name),
+	}
+	output, err := conn.DescribeDBProxies(input)
+	if tfawserr.ErrCodeEquals(err, rds.ErrCodeDBProxyNotFoundFault) {
+		return nil, &resource.NotFoundError{
+			LastError:   err,
+			LastRequest: input,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if output == nil || len(output.DBProxies) == 0 || output.DBProxies[0] == nil {
+		return nil, &resource.NotFoundError{
+			Message:     "empty result",
+			LastRequest: input,
+		}
+	}
+
+	return output.DBProxies[0], nil
+}
+
+// DBProxyStatus fetches the RDS Proxy and its Status
+func DBProxyStatus(conn *rds.RDS, name string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		proxy, err := DBProxyByName(conn, name)
+		if NotFound(err) {
+			return nil, "", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		return proxy, aws.StringValue(proxy.Status), nil
+	}
+}
+
+// DBProxyAvailable waits for an RDS Proxy to return Available
+func DBProxyAvailable(conn *rds.RDS, name string, timeout time.Duration) (*rds.DBProxy, error) {
+	stateConf := &resource.StateChangeConf{
+		Pending:    []string{rds.DBProxyStatusModifying},
+		Target:     []string{rds.DBProxyStatusAvailable},
+		Refresh:    DBProxyStatus(conn, name),
+		Timeout:    timeout,
+		MinTimeout: rdsProxyAvailableMinTimeout,
+		Delay:      rdsProxyAvailableDelay,
+	}
+
+	outputRaw, err := stateConf.WaitForState()
+	if v, ok := outputRaw.(*rds.DBProxy); ok {
+		return v, err
+	}
+	return nil, err
+}
+
+// DBProxyTargetsStatus fetches the targets of the RDS Proxy and reports whether all of them are available
+func DBProxyTargetsStatus(conn *rds.RDS, name string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		targets := make([]*rds.DBProxyTarget, 0)
+
+		err := conn.DescribeDBProxyTargetsPages(&rds.DescribeDBProxyTargetsInput{
+			DBProxyName: aws.String(name),
+		}, func(page *rds.DescribeDBProxyTargetsOutput, lastPage bool) bool {
+			targets = append(targets, page.Targets...)
+			return !lastPage
+		})
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, t := range targets {
+			// Tracked clusters carry no health of their own, their instances do
+			if t.TargetHealth == nil {
+				continue
+			}
+
+			if aws.StringValue(t.TargetHealth.State) != rds.TargetStateAvailable {
+				return targets, RdsProxyTargetsStatusPending, nil
+			}
+		}
+
+		return targets, RdsProxyTargetsStatusAvailable, nil
+	}
+}
+
+// DBProxyTargetsAvailable waits for all targets of an RDS Proxy to return Available
+func DBProxyTargetsAvailable(conn *rds.RDS, name string, timeout time.Duration) ([]*rds.DBProxyTarget, error) {
+	stateConf := &resource.StateChangeConf{
+		Pending:    []string{RdsProxyTargetsStatusPending},
+		Target:     []string{RdsProxyTargetsStatusAvailable},
+		Refresh:    DBProxyTargetsStatus(conn, name),
+		Timeout:    timeout,
+		MinTimeout: rdsProxyAvailableMinTimeout,
+		Delay:      rdsProxyAvailableDelay,
+	}
+
+	outputRaw, err := stateConf.WaitForState()
+	if v, ok := outputRaw.([]*rds.DBProxyTarget); ok && err != nil {
+		for _, t := range v {
+			if t.TargetHealth != nil && aws.StringValue(t.TargetHealth.State) != rds.TargetStateAvailable {
+				return v, fmt.Errorf("%w: target %s is %s (%s): %s", err,
+					aws.StringValue(t.RdsResourceId),
+					aws.StringValue(t.TargetHealth.State),
+					aws.StringValue(t.TargetHealth.Reason),
+					aws.StringValue(t.TargetHealth.Description))
+			}
+		}
+		return v, err
+	} else if ok {
+		return v, err
+	}
+	return nil, err
+}
+
+func resourceRdsProxyAuthAssociation() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceRdsProxyAuthAssociationCreate,
+		ReadContext:   resourceRdsProxyAuthAssociationRead,
+		UpdateContext: resourceRdsProxyAuthAssociationUpdate,
+		DeleteContext: resourceRdsProxyAuthAssociationDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"secret_id": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "id of secret",
+			},
+			"proxy_name": {
+				Type:        schema.TypeString,
+				Required:    true,
+				ForceNew:    true,
+				Description: "name of the RDS Proxy",
+			},
+			"proxy_users": {
+				Type:        schema.TypeList,
+				Description: "database users, each with the json key for the password and the secret read by the proxy",
+				Required:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"key": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringIsNotEmpty,
+							Description:  "json key of the password",
+						},
+						"username": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringIsNotEmpty,
+							Description:  "database user",
+						},
+						"secret_id": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringIsNotEmpty,
+							Description:  "id of the secret the proxy reads the username and password of the user from",
+						},
+						"iam_auth": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      rds.IAMAuthModeDisabled,
+							ValidateFunc: validation.StringInSlice(rds.IAMAuthMode_Values(), false),
+							Description:  "whether clients connect to the proxy with IAM authentication",
+						},
+					},
+				},
+			},
+			"verify":     verifySchema(),
+			"on_destroy": onDestroySchema(OnDestroyRetain, OnDestroyClearSecret),
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(RdsProxyUpdateTimeout + RdsProxyTargetsTimeout),
+		},
+	}
+}
+
+func resourceRdsProxyAuthAssociationCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	diags := syncRdsProxyUsers(ctx, d, d.Timeout(schema.TimeoutCreate))
+
+	if diags.HasError() {
+		return diags
+	}
+
+	d.SetId(getRdsProxyAuthId(d))
+
+	return diags
+}
+
+func resourceRdsProxyAuthAssociationUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	diags := syncRdsProxyUsers(ctx, d, d.Timeout(schema.TimeoutUpdate))
+
+	if diags.HasError() {
+		return diags
+	}
+
+	return append(diags, resourceRdsProxyAuthAssociationRead(ctx, d, m)...)
+}
+
+// syncRdsProxyUsers copies the passwords of proxy_users to their own secrets and registers those with the proxy.
+func syncRdsProxyUsers(ctx context.Context, d *schema.ResourceData, timeout time.Duration) diag.Diagnostics {
+	session := getSession()
+
+	push := func(p Password) diag.Diagnostics {
+		return pushRdsProxyUsers(d, p, timeout, session)
+	}
+
+	probe := func(v Verify, p Password) error {
+		return verifyRdsProxyUsers(d, v, p, session)
+	}
+
+	return pushVerified(d, session, push, probe)
+}
+
+// pushRdsProxyUsers writes the passwords to the secrets of proxy_users and registers those with the proxy.
+func pushRdsProxyUsers(d *schema.ResourceData, p Password, timeout time.Duration, session *session.Session) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	proxyName := d.Get("proxy_name").(string)
+	proxyUsers := getRdsProxyUsers(d.Get("proxy_users").([]interface{}))
+	secretsManager := secretsmanager.New(session)
+
+	secretArns := map[string]string{}
+
+	for _, user := range proxyUsers {
+
+		password, err := p.Get(user.Key)
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if err := writeRdsProxySecret(secretsManager, user, password); err != nil {
+			return diag.FromErr(fmt.Errorf("error writing RDS Proxy secret (%s): %w", user.SecretId, err))
+		}
+
+		if secretArns[user.SecretId], err = getSecretArn(secretsManager, user.SecretId); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// Users removed from proxy_users no longer have their secrets registered
+	removed := make([]string, 0)
+
+	if d.HasChange("proxy_users") {
+		o, _ := d.GetChange("proxy_users")
+		current := map[string]bool{}
+
+		for _, arn := range secretArns {
+			current[arn] = true
+		}
+
+		arns, err := getRdsProxySecretArns(secretsManager, getRdsProxyUsers(o.([]interface{})))
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		for _, arn := range arns {
+			if !current[arn] {
+				removed = append(removed, arn)
+			}
+		}
+	}
+
+	if _, err := updateRdsProxyAuth(proxyName, proxyUsers, secretArns, removed, timeout, session); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if _, err := DBProxyTargetsAvailable(rds.New(session), proxyName, timeout); err != nil {
+		return diag.FromErr(fmt.Errorf("error waiting for RDS Proxy (%s) targets: %w", proxyName, err))
+	}
+
+	return diags
+}
+
+// verifyRdsProxyUsers logs in through the proxy endpoint as every proxy_users entry. Users that must
+// connect with IAM authentication, and engine families other than Postgres and MySQL, are not verified.
+func verifyRdsProxyUsers(d *schema.ResourceData, v Verify, p Password, session *session.Session) error {
+	proxyName := d.Get("proxy_name").(string)
+	proxyUsers := getRdsProxyUsers(d.Get("proxy_users").([]interface{}))
+
+	proxy, err := DBProxyByName(rds.New(session), proxyName)
+
+	if err != nil {
+		return fmt.Errorf("error reading RDS Proxy (%s): %w", proxyName, err)
+	}
+
+	var engine, database string
+	var port int
+
+	switch aws.StringValue(proxy.EngineFamily) {
+	case rds.EngineFamilyPostgresql:
+		engine, port, database = DatabaseEnginePostgres, 5432, "postgres"
+	case rds.EngineFamilyMysql:
+		engine, port = DatabaseEngineMysql, 3306
+	default:
+		log.Printf("[WARN] not verifying RDS Proxy (%s) of engine family %s", proxyName, aws.StringValue(proxy.EngineFamily))
+		return nil
+	}
+
+	host := aws.StringValue(proxy.Endpoint)
+
+	for _, user := range proxyUsers {
+		if user.IAMAuth == rds.IAMAuthModeRequired {
+			continue
+		}
+
+		password, err := p.Get(user.Key)
+
+		if err != nil {
+			return err
+		}
+
+		err = v.Run(fmt.Sprintf("RDS Proxy login of %s at %s:%d", user.Username, host, port), func() error {
+			return verifyDatabase(engine, host, port, user.Username, password, database, "require")
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resourceRdsProxyAuthAssociationRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId(getRdsProxyAuthId(d))
+
+	return diags
+}
+
+func resourceRdsProxyAuthAssociationDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	proxyName := d.Get("proxy_name").(string)
+	proxyUsers := getRdsProxyUsers(d.Get("proxy_users").([]interface{}))
+	session := getSession()
+
+	arns, err := getRdsProxySecretArns(secretsmanager.New(session), proxyUsers)
+
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	var noAuth *RdsProxyNoAuthError
+
+	if _, err := updateRdsProxyAuth(proxyName, nil, nil, arns, d.Timeout(schema.TimeoutDelete), session); errors.As(err, &noAuth) {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("RDS Proxy (%s) auth entries kept", proxyName),
+			Detail:   "The proxy has no other auth entries, so the ones of proxy_users stay registered until it is deleted.",
+		})
+	} else if err != nil && !NotFound(err) {
+		return diag.FromErr(err)
+	}
+
+	if getOnDestroy(d) == OnDestroyClearSecret {
+		for _, user := range proxyUsers {
+			if err := clearSecret(user.SecretId, []string{"username", "password"}, session); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	return diags
+}
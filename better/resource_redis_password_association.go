@@ -0,0 +1,419 @@
+package better
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	RedisModeAcl         = "acl"
+	RedisModeRequirepass = "requirepass"
+)
+
+func getRedisPasswordId(d *schema.ResourceData) string {
+	ids := []string{
+		getSecretId(d),
+		d.Get("host").(string),
+		strconv.Itoa(d.Get("port").(int)),
+	}
+
+	return strings.Join(Compact(ids), "-")
+}
+
+// getRedis connects to the server with the current admin password, falling back to the previous one
+// while the server has not been rotated yet, and to the bootstrap password before the first rotation.
+func getRedis(d *schema.ResourceData, session *session.Session) (*RedisClient, error) {
+	secretId := getSecretId(d)
+	host := d.Get("host").(string)
+	port := d.Get("port").(int)
+	useTls := d.Get("tls").(bool)
+	adminUser := d.Get("admin_user").(string)
+	adminKey := d.Get("admin_key").(string)
+
+	passwords := make([]string, 0)
+
+	for _, stage := range []string{"AWSCURRENT", "AWSPREVIOUS"} {
+		p, _, err := getPasswordStage(secretId, stage, session)
+
+		if isSecretNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if password, err := p.Get(adminKey); err == nil {
+			passwords = append(passwords, password)
+		}
+	}
+
+	if bootstrapPassword := d.Get("bootstrap_password").(string); bootstrapPassword != "" {
+		passwords = append(passwords, bootstrapPassword)
+	}
+
+	for _, password := range passwords {
+		client, err := openRedis(host, port, useTls, adminUser, password)
+
+		if isRedisAuthError(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		return client, nil
+	}
+
+	return nil, fmt.Errorf("error authenticating to Redis (%s:%d) with the current or previous %s, or the bootstrap_password", host, port, adminKey)
+}
+
+// updateRedis sets the password of a user, or the server password when the mode is requirepass.
+func updateRedis(client *RedisClient, mode string, username string, password string) (bool, error) {
+	var err error
+
+	if mode == RedisModeRequirepass {
+		_, err = client.Do("CONFIG", "SET", "requirepass", password)
+	} else {
+		_, err = client.Do("ACL", "SETUSER", username, "resetpass", ">"+password)
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error updating Redis password (%s): %w", username, err)
+	}
+
+	return err == nil, err
+}
+
+// persistRedis writes the credentials to the ACL file or the config file, so they survive a restart.
+func persistRedis(client *RedisClient, mode string) error {
+	var err error
+
+	if mode == RedisModeRequirepass {
+		_, err = client.Do("CONFIG", "REWRITE")
+	} else {
+		_, err = client.Do("ACL", "SAVE")
+	}
+
+	if err != nil {
+		return fmt.Errorf("error persisting Redis credentials: %w", err)
+	}
+
+	return nil
+}
+
+// verifyRedis checks that the server accepts the new credential on a fresh connection.
+func verifyRedis(d *schema.ResourceData, mode string, username string, password string) error {
+	host := d.Get("host").(string)
+	port := d.Get("port").(int)
+
+	if mode == RedisModeRequirepass {
+		username = ""
+	}
+
+	client, err := openRedis(host, port, d.Get("tls").(bool), username, password)
+
+	if err != nil {
+		return fmt.Errorf("error verifying Redis (%s:%d) password (%s): %w", host, port, username, err)
+	}
+
+	return client.Close()
+}
+
+func resourceRedisPasswordAssociation() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceRedisPasswordAssociationCreate,
+		ReadContext:   resourceRedisPasswordAssociationRead,
+		UpdateContext: resourceRedisPasswordAssociationRead,
+		DeleteContext: resourceRedisPasswordAssociationDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"secret_id": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "id of secret",
+			},
+			"host": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.StringIsNotEmpty,
+				Description:  "host of the Redis server",
+			},
+			"port": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      6379,
+				ValidateFunc: validation.IsPortNumber,
+				Description:  "port of the Redis server",
+			},
+			"tls": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "whether the Redis server requires TLS",
+			},
+			"mode": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      RedisModeAcl,
+				ValidateFunc: validation.StringInSlice([]string{RedisModeAcl, RedisModeRequirepass}, false),
+				Description:  "acl to run ACL SETUSER per user, or requirepass to set the server password of legacy setups",
+			},
+			"admin_user": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "",
+				Description: "user to connect as, empty to authenticate with the password only",
+			},
+			"admin_key": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.StringIsNotEmpty,
+				Description:  "json key of the password to connect with",
+			},
+			"bootstrap_password": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				Default:     "",
+				Description: "password the server was set up with, tried when neither the current nor the previous admin_key authenticates",
+			},
+			"persist": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "whether to run ACL SAVE, or CONFIG REWRITE in requirepass mode, after the update",
+			},
+			"redis_users": {
+				Type:        schema.TypeList,
+				Description: "Redis users, each with the json key for the password and the sdm resources it is associated with",
+				Required:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"key": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringIsNotEmpty,
+							Description:  "json key of the password",
+						},
+						"username": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "default",
+							Description: "Redis ACL user, ignored in requirepass mode",
+						},
+						"sdm_ids": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Description: "ids of sdm resources",
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validation.StringIsNotEmpty,
+							},
+						},
+					},
+				},
+			},
+			"verify":               verifySchema(),
+			"wait_for_sdm_healthy": waitForSdmHealthySchema(),
+			"sdm_secret_store_id":  sdmSecretStoreIdSchema(),
+			"sdm_resource":         sdmResourceSchema(),
+			"sdm_resource_id":      sdmResourceIdSchema(),
+			"on_destroy":           onDestroySchema(OnDestroyRetain, OnDestroyScramble, OnDestroyRemoveSdmCredentials),
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(60 * time.Second),
+			Create:  schema.DefaultTimeout(SdmHealthyTimeout),
+		},
+	}
+}
+
+func resourceRedisPasswordAssociationCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	mode := d.Get("mode").(string)
+	redisUsers := getDbUsers(d.Get("redis_users").([]interface{}))
+	session := getSession()
+
+	if mode == RedisModeRequirepass && len(redisUsers) > 1 {
+		return diag.Errorf("requirepass mode takes a single redis_users entry, got %d", len(redisUsers))
+	}
+
+	push := func(p Password) diag.Diagnostics {
+		return pushRedisPasswords(ctx, d, p, session)
+	}
+
+	probe := func(v Verify, p Password) error {
+		for _, user := range redisUsers {
+			password, err := p.Get(user.Key)
+
+			if err != nil {
+				return err
+			}
+
+			err = v.Run(fmt.Sprintf("Redis AUTH of %s at %s:%d", user.Username, d.Get("host").(string), d.Get("port").(int)), func() error {
+				return verifyRedis(d, mode, user.Username, password)
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if diags = pushVerified(d, session, push, probe); diags.HasError() {
+		return diags
+	}
+
+	// The Redis resource type of StrongDM has no TLS option, ElastiCache Redis does
+	sdmResourceType := SdmResourceTypeRedis
+
+	if d.Get("tls").(bool) {
+		sdmResourceType = SdmResourceTypeElasticacheRedis
+	}
+
+	sdmResourceId, err := createSdmResource(ctx, d, sdmResourceType, redisUsers[0].Key, "", session)
+
+	if err != nil {
+		return append(diags, diag.FromErr(err)...)
+	}
+
+	if sdmResourceId != "" {
+		d.Set("sdm_resource_id", sdmResourceId)
+
+		// Keep the created sdm resource in state even if waiting fails, so it is deleted on replace
+		d.SetId(getRedisPasswordId(d))
+	}
+
+	sdmIds := append(getDbUsersSdmIds(getDbUsers(d.Get("redis_users").([]interface{}))), Compact([]string{sdmResourceId})...)
+
+	if diags = append(diags, waitForSdmHealthy(ctx, d, sdmIds, d.Timeout(schema.TimeoutCreate))...); diags.HasError() {
+		return diags
+	}
+
+	d.SetId(getRedisPasswordId(d))
+
+	return diags
+}
+
+// pushRedisPasswords sets the passwords of the redis_users on the server and, once the server accepts
+// them on a fresh connection, on StrongDM.
+func pushRedisPasswords(ctx context.Context, d *schema.ResourceData, p Password, session *session.Session) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	mode := d.Get("mode").(string)
+	redisUsers := getDbUsers(d.Get("redis_users").([]interface{}))
+
+	client, err := getRedis(d, session)
+
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	defer client.Close()
+
+	for _, user := range redisUsers {
+
+		password, err := p.Get(user.Key)
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if _, err := updateRedis(client, mode, user.Username, password); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	if d.Get("persist").(bool) {
+		if err := persistRedis(client, mode); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	for _, user := range redisUsers {
+
+		password, _ := p.Get(user.Key)
+
+		if err := verifyRedis(d, mode, user.Username, password); err != nil {
+			return diag.FromErr(err)
+		}
+
+		for _, sdmId := range user.SdmIds {
+			if _, err := updateSdm(ctx, d, sdmId, user.Key, "", password, updateSdmRedisUser); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	return diags
+}
+
+func resourceRedisPasswordAssociationRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId(getRedisPasswordId(d))
+
+	return diags
+}
+
+func resourceRedisPasswordAssociationDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	mode := d.Get("mode").(string)
+	redisUsers := getDbUsers(d.Get("redis_users").([]interface{}))
+	session := getSession()
+
+	if err := deleteSdmResource(ctx, d); err != nil {
+		return diag.FromErr(err)
+	}
+
+	switch getOnDestroy(d) {
+	case OnDestroyScramble:
+		client, err := getRedis(d, session)
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		defer client.Close()
+
+		for _, user := range redisUsers {
+			password, err := generateRandomPassword(secretsmanager.New(session))
+
+			if err != nil {
+				return diag.FromErr(err)
+			}
+
+			if _, err := updateRedis(client, mode, user.Username, password); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+
+		if d.Get("persist").(bool) {
+			if err := persistRedis(client, mode); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	case OnDestroyRemoveSdmCredentials:
+		for _, user := range redisUsers {
+			for _, sdmId := range user.SdmIds {
+				if _, err := updateSdmRedis(sdmId, "", ctx); err != nil {
+					return diag.FromErr(err)
+				}
+			}
+		}
+	}
+
+	return diags
+}
@@ -0,0 +1,433 @@
+package better
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/redshift"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/hashicorp/aws-sdk-go-base/tfawserr"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	sdm "github.com/strongdm/strongdm-sdk-go"
+)
+
+const (
+	RedshiftUpdateTimeout = 30 * time.Minute
+
+	redshiftClusterAvailableMinTimeout = 10 * time.Second
+	redshiftClusterAvailableDelay      = 30 * time.Second
+
+	RedshiftClusterStatusAvailable = "available"
+	RedshiftClusterStatusModifying = "modifying"
+	RedshiftClusterStatusRebooting = "rebooting"
+	RedshiftClusterStatusResizing  = "resizing"
+)
+
+func getRedshiftPasswordId(d *schema.ResourceData) string {
+	ids := []string{
+		getSecretId(d),
+		d.Get("cluster_id").(string),
+	}
+
+	return strings.Join(Compact(ids), "-")
+}
+
+func updateRedshift(id string, password string, session *session.Session) (bool, error) {
+	redshiftClient := redshift.New(session)
+
+	_, err := redshiftClient.ModifyCluster(&redshift.ModifyClusterInput{
+		ClusterIdentifier:  aws.String(id),
+		MasterUserPassword: aws.String(password),
+	})
+
+	if err != nil {
+		return false, fmt.Errorf("error updating Redshift Cluster password (%s): %w", id, err)
+	}
+
+	if _, err := RedshiftClusterAvailable(redshiftClient, id); err != nil {
+		return false, fmt.Errorf("error waiting for Redshift Cluster (%s) update: %w", id, err)
+	}
+
+	return err == nil, err
+}
+
+// updateRedshiftUsers sets the passwords of non admin users with ALTER USER, connected as the master user.
+func updateRedshiftUsers(ctx context.Context, id string, adminPassword string, passwords map[string]string, session *session.Session) error {
+	cluster, err := RedshiftClusterByID(redshift.New(session), id)
+
+	if err != nil {
+		return fmt.Errorf("error reading Redshift Cluster (%s): %w", id, err)
+	}
+
+	if cluster.Endpoint == nil {
+		return fmt.Errorf("Redshift Cluster (%s) has no endpoint", id)
+	}
+
+	db, err := openPostgres(
+		ctx,
+		aws.StringValue(cluster.Endpoint.Address),
+		int(aws.Int64Value(cluster.Endpoint.Port)),
+		aws.StringValue(cluster.MasterUsername),
+		adminPassword,
+		aws.StringValue(cluster.DBName),
+		"require",
+	)
+
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	for username, password := range passwords {
+		if err := alterPostgresUserPassword(ctx, db, username, password); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RedshiftClusterByID retrieves a Redshift Cluster by id.
+func RedshiftClusterByID(conn *redshift.Redshift, id string) (*redshift.Cluster, error) {
+	input := &redshift.DescribeClustersInput{
+		ClusterIdentifier: aws.String(id),
+	}
+	output, err := conn.DescribeClusters(input)
+	if tfawserr.ErrCodeEquals(err, redshift.ErrCodeClusterNotFoundFault) {
+		return nil, &resource.NotFoundError{
+			LastError:   err,
+			LastRequest: input,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if output == nil || len(output.Clusters) == 0 || output.Clusters[0] == nil {
+		return nil, &resource.NotFoundError{
+			Message:     "empty result",
+			LastRequest: input,
+		}
+	}
+
+	return output.Clusters[0], nil
+}
+
+// RedshiftClusterStatus fetches the Redshift Cluster and its Status. A cluster whose master
+// password change is still pending is reported as modifying.
+func RedshiftClusterStatus(conn *redshift.Redshift, id string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		cluster, err := RedshiftClusterByID(conn, id)
+		if NotFound(err) {
+			return nil, "", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		if cluster.PendingModifiedValues != nil && cluster.PendingModifiedValues.MasterUserPassword != nil {
+			return cluster, RedshiftClusterStatusModifying, nil
+		}
+
+		return cluster, aws.StringValue(cluster.ClusterStatus), nil
+	}
+}
+
+// RedshiftClusterAvailable waits for a Redshift Cluster to return Available
+func RedshiftClusterAvailable(conn *redshift.Redshift, id string) (*redshift.Cluster, error) {
+	stateConf := &resource.StateChangeConf{
+		Pending: []string{
+			RedshiftClusterStatusModifying,
+			RedshiftClusterStatusRebooting,
+			RedshiftClusterStatusResizing,
+		},
+		Target:     []string{RedshiftClusterStatusAvailable},
+		Refresh:    RedshiftClusterStatus(conn, id),
+		Timeout:    RedshiftUpdateTimeout,
+		MinTimeout: redshiftClusterAvailableMinTimeout,
+		Delay:      redshiftClusterAvailableDelay,
+	}
+
+	outputRaw, err := stateConf.WaitForState()
+	if v, ok := outputRaw.(*redshift.Cluster); ok {
+		return v, err
+	}
+	return nil, err
+}
+
+// updateSdmRedshift sets the password of a StrongDM Redshift resource, and its username unless empty.
+func updateSdmRedshift(id string, username string, password string, ctx context.Context) (bool, error) {
+	if client, err := getSdmClient(); client == nil {
+		return false, err
+	} else {
+		if r, err := client.Resources().Get(ctx, id); err != nil {
+			return err == nil, err
+		} else {
+			switch r.Resource.(type) {
+			case *sdm.Redshift:
+			default:
+				return false, fmt.Errorf("sdm resource (%s) of type %T is not a Redshift resource", id, r.Resource)
+			}
+
+			if err := setSdmPlainCredentials(r.Resource, username, password); err != nil {
+				return false, err
+			}
+
+			_, err := client.Resources().Update(ctx, r.Resource)
+
+			return err == nil, err
+		}
+	}
+}
+
+func resourceRedshiftPasswordAssociation() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceRedshiftPasswordAssociationCreate,
+		ReadContext:   resourceRedshiftPasswordAssociationRead,
+		UpdateContext: resourceRedshiftPasswordAssociationRead,
+		DeleteContext: resourceRedshiftPasswordAssociationDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"secret_id": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "id of secret",
+			},
+			"cluster_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "",
+				Description: "id of the Redshift cluster",
+			},
+			"alter_users": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "set the passwords of db_users with a username other than the admin with ALTER USER",
+			},
+			"db_users": {
+				Type:        schema.TypeList,
+				Description: "database users, each with the json key for the password and the sdm resources it is associated with",
+				Required:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"key": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringIsNotEmpty,
+							Description:  "json key of the password, ADMIN_PASSWORD is set as the cluster master password",
+						},
+						"username": {
+							Type:        schema.TypeString,
+							Optional:    true,
+							Default:     "",
+							Description: "database user, required for alter_users and set on the sdm resources",
+						},
+						"sdm_ids": {
+							Type:        schema.TypeList,
+							Optional:    true,
+							Description: "ids of sdm resources",
+							Elem: &schema.Schema{
+								Type:         schema.TypeString,
+								ValidateFunc: validation.StringIsNotEmpty,
+							},
+						},
+					},
+				},
+			},
+			"verify":               verifySchema(),
+			"wait_for_sdm_healthy": waitForSdmHealthySchema(),
+			"sdm_secret_store_id":  sdmSecretStoreIdSchema(),
+			"on_destroy":           onDestroySchema(OnDestroyRetain, OnDestroyScramble, OnDestroyRemoveSdmCredentials),
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Default: schema.DefaultTimeout(60 * time.Second),
+			Create:  schema.DefaultTimeout(SdmHealthyTimeout),
+		},
+	}
+}
+
+func resourceRedshiftPasswordAssociationCreate(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	session := getSession()
+
+	push := func(p Password) diag.Diagnostics {
+		return pushRedshiftPasswords(ctx, d, p, session)
+	}
+
+	probe := func(v Verify, p Password) error {
+		return verifyRedshiftPasswords(d, v, p, session)
+	}
+
+	if diags = pushVerified(d, session, push, probe); diags.HasError() {
+		return diags
+	}
+
+	if diags = append(diags, waitForSdmHealthy(ctx, d, getDbUsersSdmIds(getDbUsers(d.Get("db_users").([]interface{}))), d.Timeout(schema.TimeoutCreate))...); diags.HasError() {
+		return diags
+	}
+
+	d.SetId(getRedshiftPasswordId(d))
+
+	return diags
+}
+
+// pushRedshiftPasswords sets the passwords of the db_users on the cluster and on StrongDM.
+func pushRedshiftPasswords(ctx context.Context, d *schema.ResourceData, p Password, session *session.Session) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	clusterId := d.Get("cluster_id").(string)
+	dbUsers := getDbUsers(d.Get("db_users").([]interface{}))
+
+	passwords := map[string]string{}
+
+	for _, user := range dbUsers {
+
+		password, err := p.Get(user.Key)
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if clusterId != "" && user.Key == "ADMIN_PASSWORD" {
+			if _, err := updateRedshift(clusterId, password, session); err != nil {
+				return diag.FromErr(err)
+			}
+		} else if user.Username != "" {
+			passwords[user.Username] = password
+		}
+	}
+
+	if clusterId != "" && d.Get("alter_users").(bool) && len(passwords) > 0 {
+		adminPassword, err := p.Get("ADMIN_PASSWORD")
+
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if err := updateRedshiftUsers(ctx, clusterId, adminPassword, passwords, session); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// Only point StrongDM at the new passwords once the cluster accepts them
+	for _, user := range dbUsers {
+
+		password, _ := p.Get(user.Key)
+
+		for _, sdmId := range user.SdmIds {
+			if _, err := updateSdm(ctx, d, sdmId, user.Key, user.Username, password, updateSdmRedshift); err != nil {
+				return diag.FromErr(err)
+			}
+		}
+	}
+
+	return diags
+}
+
+// verifyRedshiftPasswords logs in to the cluster as the master user and, with alter_users, as the other db_users.
+func verifyRedshiftPasswords(d *schema.ResourceData, v Verify, p Password, session *session.Session) error {
+	clusterId := d.Get("cluster_id").(string)
+	dbUsers := getDbUsers(d.Get("db_users").([]interface{}))
+
+	if clusterId == "" {
+		return nil
+	}
+
+	cluster, err := RedshiftClusterByID(redshift.New(session), clusterId)
+
+	if err != nil {
+		return fmt.Errorf("error reading Redshift Cluster (%s): %w", clusterId, err)
+	}
+
+	if cluster.Endpoint == nil {
+		return fmt.Errorf("Redshift Cluster (%s) has no endpoint", clusterId)
+	}
+
+	host := aws.StringValue(cluster.Endpoint.Address)
+	port := int(aws.Int64Value(cluster.Endpoint.Port))
+
+	for _, user := range dbUsers {
+
+		username := user.Username
+
+		if user.Key == "ADMIN_PASSWORD" {
+			username = aws.StringValue(cluster.MasterUsername)
+		} else if !d.Get("alter_users").(bool) {
+			continue
+		}
+
+		if username == "" {
+			continue
+		}
+
+		password, err := p.Get(user.Key)
+
+		if err != nil {
+			return err
+		}
+
+		err = v.Run(fmt.Sprintf("Redshift login of %s at %s:%d", username, host, port), func() error {
+			return verifyDatabase(DatabaseEnginePostgres, host, port, username, password, aws.StringValue(cluster.DBName), "require")
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resourceRedshiftPasswordAssociationRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	d.SetId(getRedshiftPasswordId(d))
+
+	return diags
+}
+
+func resourceRedshiftPasswordAssociationDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	clusterId := d.Get("cluster_id").(string)
+	dbUsers := getDbUsers(d.Get("db_users").([]interface{}))
+	session := getSession()
+
+	for _, user := range dbUsers {
+
+		switch getOnDestroy(d) {
+		case OnDestroyScramble:
+			if clusterId != "" && user.Key == "ADMIN_PASSWORD" {
+				password, err := generateRandomPassword(secretsmanager.New(session))
+
+				if err != nil {
+					return diag.FromErr(err)
+				}
+
+				if _, err := updateRedshift(clusterId, password, session); err != nil {
+					return diag.FromErr(err)
+				}
+			}
+		case OnDestroyRemoveSdmCredentials:
+			for _, sdmId := range user.SdmIds {
+				if _, err := updateSdmRedshift(sdmId, "", "", ctx); err != nil {
+					return diag.FromErr(err)
+				}
+			}
+		}
+	}
+
+	return diags
+}
@@ -0,0 +1,600 @@
+package better
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	sdm "github.com/strongdm/strongdm-sdk-go"
+)
+
+const (
+	SdmHealthyTimeout = 5 * time.Minute
+
+	sdmHealthyMinTimeout = 10 * time.Second
+	sdmHealthyDelay      = 5 * time.Second
+
+	SdmResourceStatusHealthy   = "healthy"
+	SdmResourceStatusUnhealthy = "unhealthy"
+
+	SdmResourceTypePostgres         = "postgres"
+	SdmResourceTypeMysql            = "mysql"
+	SdmResourceTypeRedis            = "redis"
+	SdmResourceTypeElasticacheRedis = "elasticache_redis"
+	SdmResourceTypeHttpBasicAuth    = "http_basic_auth"
+)
+
+// SdmResource is a StrongDM resource managed by an association through its sdm_resource block.
+type SdmResource struct {
+	Name     string
+	Hostname string
+	Port     int
+	Database string
+	Username string
+	Key      string
+	Tags     map[string]string
+}
+
+// SdmCredentials holds the credential related fields of a StrongDM resource.
+type SdmCredentials struct {
+	Type     string
+	Username string
+	Password string
+	Healthy  bool
+}
+
+// getSdmClient returns a StrongDM client, or nil when SDM_API_ACCESS_KEY and SDM_API_SECRET_KEY are not set.
+func getSdmClient() (*sdm.Client, error) {
+	accessKey := os.Getenv("SDM_API_ACCESS_KEY")
+	secretKey := os.Getenv("SDM_API_SECRET_KEY")
+
+	if accessKey == "" || secretKey == "" {
+		return nil, nil
+	}
+
+	return sdm.New(accessKey, secretKey)
+}
+
+// getSdmCredentials returns the credentials of the StrongDM resource types managed by this provider.
+func getSdmCredentials(r sdm.Resource) (SdmCredentials, error) {
+	switch v := r.(type) {
+	case *sdm.Postgres:
+		return SdmCredentials{"postgres", v.Username, v.Password, v.Healthy}, nil
+	case *sdm.Mysql:
+		return SdmCredentials{"mysql", v.Username, v.Password, v.Healthy}, nil
+	case *sdm.Redshift:
+		return SdmCredentials{"redshift", v.Username, v.Password, v.Healthy}, nil
+	case *sdm.ElasticacheRedis:
+		return SdmCredentials{"elasticache_redis", "", v.Password, v.Healthy}, nil
+	case *sdm.Redis:
+		return SdmCredentials{"redis", "", v.Password, v.Healthy}, nil
+	case *sdm.HTTPBasicAuth:
+		return SdmCredentials{"http_basic_auth", v.Username, v.Password, v.Healthy}, nil
+	case *sdm.Elastic:
+		return SdmCredentials{"elastic", v.Username, v.Password, v.Healthy}, nil
+	case *sdm.MongoHost:
+		return SdmCredentials{"mongo_host", v.Username, v.Password, v.Healthy}, nil
+	case *sdm.MongoReplicaSet:
+		return SdmCredentials{"mongo_replica_set", v.Username, v.Password, v.Healthy}, nil
+	case *sdm.MongoLegacyHost:
+		return SdmCredentials{"mongo_legacy_host", v.Username, v.Password, v.Healthy}, nil
+	case *sdm.MongoLegacyReplicaset:
+		return SdmCredentials{"mongo_legacy_replicaset", v.Username, v.Password, v.Healthy}, nil
+	}
+
+	return SdmCredentials{}, fmt.Errorf("unsupported StrongDM resource type %T (%s)", r, r.GetID())
+}
+
+// setSdmPlainCredentials sets the password, and the username unless empty, of a StrongDM resource as
+// plain values, detaching the resource from any secret store so they are not read as paths.
+func setSdmPlainCredentials(r sdm.Resource, username string, password string) error {
+	r.SetSecretStoreID("")
+
+	return setSdmCredentials(r, username, password)
+}
+
+// setSdmCredentials sets the password of a StrongDM resource, and its username unless empty.
+// Resource types without a username only take the password.
+func setSdmCredentials(r sdm.Resource, username string, password string) error {
+	switch v := r.(type) {
+	case *sdm.Postgres:
+		v.Password = password
+		if username != "" {
+			v.Username = username
+		}
+	case *sdm.Mysql:
+		v.Password = password
+		if username != "" {
+			v.Username = username
+		}
+	case *sdm.Redshift:
+		v.Password = password
+		if username != "" {
+			v.Username = username
+		}
+	case *sdm.ElasticacheRedis:
+		v.Password = password
+	case *sdm.Redis:
+		v.Password = password
+	case *sdm.HTTPBasicAuth:
+		v.Password = password
+		if username != "" {
+			v.Username = username
+		}
+	case *sdm.Elastic:
+		v.Password = password
+		if username != "" {
+			v.Username = username
+		}
+	case *sdm.MongoHost:
+		v.Password = password
+		if username != "" {
+			v.Username = username
+		}
+	case *sdm.MongoReplicaSet:
+		v.Password = password
+		if username != "" {
+			v.Username = username
+		}
+	case *sdm.MongoLegacyHost:
+		v.Password = password
+		if username != "" {
+			v.Username = username
+		}
+	case *sdm.MongoLegacyReplicaset:
+		v.Password = password
+		if username != "" {
+			v.Username = username
+		}
+	default:
+		return fmt.Errorf("unsupported StrongDM resource type %T (%s)", r, r.GetID())
+	}
+
+	return nil
+}
+
+func waitForSdmHealthySchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeBool,
+		Optional:    true,
+		Default:     false,
+		Description: "whether to wait, within the create or update timeout, for the sdm resources to report healthy after their credentials are updated. Requires SDM_API_ACCESS_KEY and SDM_API_SECRET_KEY",
+	}
+}
+
+// getDbUsersSdmIds returns the sdm resources of all users.
+func getDbUsersSdmIds(users []DbUser) []string {
+	ids := make([]string, 0)
+
+	for _, u := range users {
+		ids = append(ids, u.SdmIds...)
+	}
+
+	return ids
+}
+
+// SdmResourceStatus fetches the StrongDM resource and whether it is healthy
+func SdmResourceStatus(ctx context.Context, client *sdm.Client, id string) resource.StateRefreshFunc {
+	return func() (interface{}, string, error) {
+		r, err := client.Resources().Get(ctx, id)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		credentials, err := getSdmCredentials(r.Resource)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		if !credentials.Healthy {
+			log.Printf("[INFO] waiting for sdm resource %s (%s) to become healthy", r.Resource.GetName(), id)
+			return r.Resource, SdmResourceStatusUnhealthy, nil
+		}
+
+		log.Printf("[INFO] sdm resource %s (%s) is healthy", r.Resource.GetName(), id)
+
+		return r.Resource, SdmResourceStatusHealthy, nil
+	}
+}
+
+// SdmResourceHealthy waits for a StrongDM resource to return Healthy
+func SdmResourceHealthy(ctx context.Context, client *sdm.Client, id string, timeout time.Duration) (sdm.Resource, error) {
+	stateConf := &resource.StateChangeConf{
+		Pending:    []string{SdmResourceStatusUnhealthy},
+		Target:     []string{SdmResourceStatusHealthy},
+		Refresh:    SdmResourceStatus(ctx, client, id),
+		Timeout:    timeout,
+		MinTimeout: sdmHealthyMinTimeout,
+		Delay:      sdmHealthyDelay,
+	}
+
+	outputRaw, err := stateConf.WaitForStateContext(ctx)
+	if v, ok := outputRaw.(sdm.Resource); ok {
+		return v, err
+	}
+	return nil, err
+}
+
+// waitForSdmHealthy waits, within the timeout of the operation, for the sdm resources to report healthy
+// when the association has wait_for_sdm_healthy set, reporting all resources that did not.
+func waitForSdmHealthy(ctx context.Context, d *schema.ResourceData, ids []string, timeout time.Duration) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	if !d.Get("wait_for_sdm_healthy").(bool) || len(ids) == 0 {
+		return diags
+	}
+
+	client, err := getSdmClient()
+
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if client == nil {
+		return diag.Errorf("wait_for_sdm_healthy requires SDM_API_ACCESS_KEY and SDM_API_SECRET_KEY")
+	}
+
+	unhealthy := make([]string, 0)
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for _, id := range ids {
+		if _, err := SdmResourceHealthy(waitCtx, client, id, timeout); err != nil {
+			log.Printf("[WARN] sdm resource (%s) did not become healthy: %s", id, err)
+			unhealthy = append(unhealthy, fmt.Sprintf("%s: %s", id, err))
+		}
+	}
+
+	if len(unhealthy) > 0 {
+		diags = append(diags, diag.Diagnostic{
+			Severity: diag.Error,
+			Summary:  fmt.Sprintf("%d of %d sdm resources did not become healthy", len(unhealthy), len(ids)),
+			Detail:   strings.Join(unhealthy, "\n"),
+		})
+	}
+
+	return diags
+}
+
+func sdmSecretStoreIdSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeString,
+		Optional:    true,
+		Default:     "",
+		Description: "id of a StrongDM secret store backed by AWS Secrets Manager, to point the sdm resources at the secret instead of copying the passwords into them. Only secrets in rds format hold a username, so other sdm resources with a username must already reference it in the store",
+	}
+}
+
+// getSdmSecretPath returns the path StrongDM resources use to reference a json key of the secret.
+func getSdmSecretPath(secretId string, key string) string {
+	return secretId + "#" + key
+}
+
+// updateSdmSecretStore points a StrongDM resource at the secret store, with the paths of its password and,
+// unless empty, its username. Resources already pointing there are left alone, so rotations do not write to StrongDM.
+// Without a username path, a resource not yet on the store must have no username, which would otherwise be read
+// as a path of the store.
+func updateSdmSecretStore(id string, secretStoreId string, usernamePath string, passwordPath string, ctx context.Context) (bool, error) {
+	if client, err := getSdmClient(); client == nil {
+		return false, err
+	} else {
+		if r, err := client.Resources().Get(ctx, id); err != nil {
+			return err == nil, err
+		} else {
+			credentials, err := getSdmCredentials(r.Resource)
+
+			if err != nil {
+				return false, err
+			}
+
+			if r.Resource.GetSecretStoreID() == secretStoreId && credentials.Password == passwordPath &&
+				(usernamePath == "" || credentials.Username == usernamePath) {
+				log.Printf("[DEBUG] sdm resource %s (%s) already references %s", r.Resource.GetName(), id, passwordPath)
+				return false, nil
+			}
+
+			if usernamePath == "" && credentials.Username != "" && r.Resource.GetSecretStoreID() != secretStoreId {
+				return false, fmt.Errorf("sdm resource (%s) has a plain username, put it on the secret store (%s) with its username as a path of the store first", id, secretStoreId)
+			}
+
+			r.Resource.SetSecretStoreID(secretStoreId)
+
+			if err := setSdmCredentials(r.Resource, usernamePath, passwordPath); err != nil {
+				return false, err
+			}
+
+			_, err = client.Resources().Update(ctx, r.Resource)
+
+			return err == nil, err
+		}
+	}
+}
+
+// updateSdm sets the password of a json key on a StrongDM resource with update or, when the association
+// has sdm_secret_store_id set, points the resource at the key in the secret store instead. The secret
+// holds no usernames, so the username is not written in that case.
+func updateSdm(ctx context.Context, d *schema.ResourceData, id string, key string, username string, password string,
+	update func(string, string, string, context.Context) (bool, error)) (bool, error) {
+	if secretStoreId := d.Get("sdm_secret_store_id").(string); secretStoreId != "" {
+		return updateSdmSecretStore(id, secretStoreId, "", getSdmSecretPath(getSecretId(d), key), ctx)
+	}
+
+	return update(id, username, password, ctx)
+}
+
+func sdmResourceSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		ForceNew:    true,
+		MaxItems:    1,
+		Description: "sdm resource to create with the current password, and to delete on destroy",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"name": {
+					Type:         schema.TypeString,
+					Required:     true,
+					ValidateFunc: validation.StringIsNotEmpty,
+					Description:  "name of the sdm resource, also the subdomain of HTTP resources",
+				},
+				"hostname": {
+					Type:         schema.TypeString,
+					Required:     true,
+					ValidateFunc: validation.StringIsNotEmpty,
+					Description:  "hostname the sdm resource connects to",
+				},
+				"port": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      0,
+					ValidateFunc: validation.Any(validation.IntInSlice([]int{0}), validation.IsPortNumber),
+					Description:  "port the sdm resource connects to, 0 for the default of the resource type",
+				},
+				"database": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Default:     "",
+					Description: "database of Postgres and MySQL resources",
+				},
+				"username": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Default:     "",
+					Description: "username of the sdm resource, empty for the username of the association. With sdm_secret_store_id, a path of the secret store",
+				},
+				"key": {
+					Type:        schema.TypeString,
+					Optional:    true,
+					Default:     "",
+					Description: "json key of the password, empty for the key of the association",
+				},
+				"tags": {
+					Type:        schema.TypeMap,
+					Optional:    true,
+					Description: "tags of the sdm resource",
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+			},
+		},
+	}
+}
+
+func sdmResourceIdSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeString,
+		Computed:    true,
+		Description: "id of the sdm resource created from sdm_resource",
+	}
+}
+
+func getSdmResource(d *schema.ResourceData) (SdmResource, bool) {
+	sdmResource := d.Get("sdm_resource").([]interface{})
+
+	if len(sdmResource) == 0 || sdmResource[0] == nil {
+		return SdmResource{}, false
+	}
+
+	r := sdmResource[0].(map[string]interface{})
+	tags := map[string]string{}
+
+	for k, v := range r["tags"].(map[string]interface{}) {
+		tags[k] = v.(string)
+	}
+
+	return SdmResource{
+		Name:     r["name"].(string),
+		Hostname: r["hostname"].(string),
+		Port:     r["port"].(int),
+		Database: r["database"].(string),
+		Username: r["username"].(string),
+		Key:      r["key"].(string),
+		Tags:     tags,
+	}, true
+}
+
+// newSdmResource builds a StrongDM resource of the given type, defaulting the port of the type.
+func newSdmResource(resourceType string, r SdmResource, username string, password string) (sdm.Resource, error) {
+	port := int32(r.Port)
+
+	switch resourceType {
+	case SdmResourceTypePostgres:
+		if port == 0 {
+			port = 5432
+		}
+
+		return &sdm.Postgres{
+			Name:     r.Name,
+			Tags:     r.Tags,
+			Hostname: r.Hostname,
+			Port:     port,
+			Database: r.Database,
+			Username: username,
+			Password: password,
+		}, nil
+	case SdmResourceTypeMysql:
+		if port == 0 {
+			port = 3306
+		}
+
+		return &sdm.Mysql{
+			Name:     r.Name,
+			Tags:     r.Tags,
+			Hostname: r.Hostname,
+			Port:     port,
+			Database: r.Database,
+			Username: username,
+			Password: password,
+		}, nil
+	case SdmResourceTypeRedis:
+		if port == 0 {
+			port = 6379
+		}
+
+		return &sdm.Redis{
+			Name:     r.Name,
+			Tags:     r.Tags,
+			Hostname: r.Hostname,
+			Port:     port,
+			Password: password,
+		}, nil
+	case SdmResourceTypeElasticacheRedis:
+		if port == 0 {
+			port = 6379
+		}
+
+		return &sdm.ElasticacheRedis{
+			Name:        r.Name,
+			Tags:        r.Tags,
+			Hostname:    r.Hostname,
+			Port:        port,
+			Password:    password,
+			TlsRequired: true,
+		}, nil
+	case SdmResourceTypeHttpBasicAuth:
+		url := fmt.Sprintf("https://%s/", r.Hostname)
+
+		if port != 0 {
+			url = fmt.Sprintf("https://%s:%d/", r.Hostname, port)
+		}
+
+		return &sdm.HTTPBasicAuth{
+			Name:            r.Name,
+			Tags:            r.Tags,
+			Url:             url,
+			HealthcheckPath: "/",
+			Subdomain:       r.Name,
+			Username:        username,
+			Password:        password,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported sdm resource type %s", resourceType)
+}
+
+// createSdmResource creates the sdm resource of the sdm_resource block, if any, with the current password
+// of its key, or referencing it when the association has sdm_secret_store_id set, and returns its id.
+func createSdmResource(ctx context.Context, d *schema.ResourceData, resourceType string, key string, username string, session *session.Session) (string, error) {
+	r, ok := getSdmResource(d)
+
+	if !ok {
+		return "", nil
+	}
+
+	if r.Key != "" {
+		key = r.Key
+	}
+
+	if r.Username != "" {
+		username = r.Username
+	}
+
+	secretId := getSecretId(d)
+	secretStoreId := d.Get("sdm_secret_store_id").(string)
+
+	if secretStoreId != "" && username != "" && !strings.HasPrefix(username, getSdmSecretPath(secretId, "")) && r.Username == "" {
+		return "", fmt.Errorf("sdm_resource (%s) needs a username that is a path of the secret store (%s), as the secret holds no username", r.Name, secretStoreId)
+	}
+
+	password := getSdmSecretPath(secretId, key)
+
+	if secretStoreId == "" {
+		p, err := getPassword(secretId, session)
+
+		if err != nil {
+			return "", err
+		}
+
+		if password, err = p.Get(key); err != nil {
+			return "", err
+		}
+	}
+
+	resource, err := newSdmResource(resourceType, r, username, password)
+
+	if err != nil {
+		return "", err
+	}
+
+	resource.SetSecretStoreID(secretStoreId)
+
+	client, err := getSdmClient()
+
+	if err != nil {
+		return "", err
+	} else if client == nil {
+		return "", errors.New("SDM_API_ACCESS_KEY and SDM_API_SECRET_KEY are required to create sdm_resource")
+	}
+
+	resp, err := client.Resources().Create(ctx, resource)
+
+	if err != nil {
+		return "", fmt.Errorf("error creating sdm resource (%s): %w", r.Name, err)
+	}
+
+	log.Printf("[INFO] created sdm resource %s (%s)", r.Name, resp.Resource.GetID())
+
+	return resp.Resource.GetID(), nil
+}
+
+// deleteSdmResource deletes the sdm resource created from the sdm_resource block, if any.
+func deleteSdmResource(ctx context.Context, d *schema.ResourceData) error {
+	id := d.Get("sdm_resource_id").(string)
+
+	if id == "" {
+		return nil
+	}
+
+	client, err := getSdmClient()
+
+	if err != nil {
+		return err
+	} else if client == nil {
+		return errors.New("SDM_API_ACCESS_KEY and SDM_API_SECRET_KEY are required to delete sdm_resource")
+	}
+
+	if _, err := client.Resources().Delete(ctx, id); err != nil {
+		var notFound *sdm.NotFoundError
+
+		if errors.As(err, &notFound) {
+			return nil
+		}
+
+		return fmt.Errorf("error deleting sdm resource (%s): %w", id, err)
+	}
+
+	return nil
+}
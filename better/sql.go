@@ -0,0 +1,160 @@
+package better
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+const (
+	DatabaseEnginePostgres = "postgres"
+	DatabaseEngineMysql    = "mysql"
+)
+
+// sqlConn is satisfied by both *sql.DB and *sql.Conn, the latter pinning statements to one session.
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// openDatabase opens a connection to a Postgres or MySQL database and checks that it authenticates.
+func openDatabase(ctx context.Context, engine string, host string, port int, username string, password string, database string, sslmode string) (*sql.DB, error) {
+	if engine == DatabaseEngineMysql {
+		return openMysql(ctx, host, port, username, password, database, sslmode)
+	}
+
+	return openPostgres(ctx, host, port, username, password, database, sslmode)
+}
+
+// alterUserPassword sets the password of a Postgres or MySQL database user.
+func alterUserPassword(ctx context.Context, engine string, db sqlConn, username string, password string) error {
+	if engine == DatabaseEngineMysql {
+		return alterMysqlUserPassword(ctx, db, username, password)
+	}
+
+	return alterPostgresUserPassword(ctx, db, username, password)
+}
+
+// openPostgres opens a connection to a Postgres compatible database and checks that it authenticates.
+func openPostgres(ctx context.Context, host string, port int, username string, password string, database string, sslmode string) (*sql.DB, error) {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(username, password),
+		Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:     "/" + database,
+		RawQuery: url.Values{"sslmode": []string{sslmode}}.Encode(),
+	}
+
+	db, err := sql.Open("postgres", dsn.String())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error connecting to %s as %s: %w", dsn.Host, username, err)
+	}
+
+	return db, nil
+}
+
+// alterPostgresUserPassword sets the password of a Postgres compatible database user.
+// ALTER USER takes no bind parameters, so the user and password are quoted instead.
+func alterPostgresUserPassword(ctx context.Context, db sqlConn, username string, password string) error {
+	query := fmt.Sprintf("ALTER USER %s PASSWORD %s", pq.QuoteIdentifier(username), pq.QuoteLiteral(password))
+
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("error updating password of database user (%s): %w", username, err)
+	}
+
+	return nil
+}
+
+// openMysql opens a connection to a MySQL database and checks that it authenticates.
+// The Postgres sslmode values are mapped onto the tls option of the driver.
+func openMysql(ctx context.Context, host string, port int, username string, password string, database string, sslmode string) (*sql.DB, error) {
+	config := mysql.NewConfig()
+	config.Net = "tcp"
+	config.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	config.User = username
+	config.Passwd = password
+	config.DBName = database
+
+	switch sslmode {
+	case "disable":
+		config.TLSConfig = "false"
+	case "require":
+		config.TLSConfig = "skip-verify"
+	default:
+		config.TLSConfig = "true"
+	}
+
+	db, err := sql.Open("mysql", config.FormatDSN())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error connecting to %s as %s: %w", config.Addr, username, err)
+	}
+
+	return db, nil
+}
+
+// alterMysqlUserPassword sets the password of a MySQL user for every host it is defined for.
+func alterMysqlUserPassword(ctx context.Context, db sqlConn, username string, password string) error {
+	rows, err := db.QueryContext(ctx, "SELECT host FROM mysql.user WHERE user = ?", username)
+
+	if err != nil {
+		return fmt.Errorf("error reading hosts of database user (%s): %w", username, err)
+	}
+
+	hosts := make([]string, 0)
+
+	for rows.Next() {
+		var host string
+
+		if err := rows.Scan(&host); err != nil {
+			rows.Close()
+			return err
+		}
+
+		hosts = append(hosts, host)
+	}
+
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(hosts) == 0 {
+		return fmt.Errorf("database user (%s) does not exist", username)
+	}
+
+	for _, host := range hosts {
+		query := fmt.Sprintf("ALTER USER %s@%s IDENTIFIED BY %s",
+			mysqlQuoteLiteral(username), mysqlQuoteLiteral(host), mysqlQuoteLiteral(password))
+
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("error updating password of database user (%s@%s): %w", username, host, err)
+		}
+	}
+
+	return nil
+}
+
+// mysqlQuoteLiteral quotes a string literal, as ALTER USER takes no bind parameters.
+func mysqlQuoteLiteral(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(s) + "'"
+}
@@ -0,0 +1,285 @@
+package better
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	VerifyOnFailureFail     = "fail"
+	VerifyOnFailureRollback = "rollback"
+
+	verifyProbeTimeout = 30 * time.Second
+)
+
+// Verify configures how rotated credentials are checked against their targets.
+type Verify struct {
+	Attempts  int
+	Delay     time.Duration
+	OnFailure string
+}
+
+func verifySchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		MaxItems:    1,
+		Description: "check that the rotated credentials authenticate against their targets",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"attempts": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      10,
+					ValidateFunc: validation.IntAtLeast(1),
+					Description:  "number of attempts per credential",
+				},
+				"delay": {
+					Type:         schema.TypeInt,
+					Optional:     true,
+					Default:      15,
+					ValidateFunc: validation.IntAtLeast(0),
+					Description:  "seconds between attempts",
+				},
+				"on_failure": {
+					Type:         schema.TypeString,
+					Optional:     true,
+					Default:      VerifyOnFailureFail,
+					ValidateFunc: validation.StringInSlice([]string{VerifyOnFailureFail, VerifyOnFailureRollback}, false),
+					Description:  "fail to only fail the apply, or rollback to also push back the previous passwords and restore the previous secret version",
+				},
+			},
+		},
+	}
+}
+
+func getVerify(d *schema.ResourceData) (Verify, bool) {
+	verify := d.Get("verify").([]interface{})
+
+	if len(verify) == 0 || verify[0] == nil {
+		return Verify{}, false
+	}
+
+	v := verify[0].(map[string]interface{})
+
+	return Verify{
+		Attempts:  v["attempts"].(int),
+		Delay:     time.Duration(v["delay"].(int)) * time.Second,
+		OnFailure: v["on_failure"].(string),
+	}, true
+}
+
+// Run calls probe until it succeeds or the attempts are exhausted, returning the last error.
+func (v Verify) Run(name string, probe func() error) error {
+	var err error
+
+	for i := 1; i <= v.Attempts; i++ {
+		if err = probe(); err == nil {
+			log.Printf("[DEBUG] verified %s", name)
+			return nil
+		}
+
+		log.Printf("[WARN] verifying %s failed (attempt %d/%d): %s", name, i, v.Attempts, err)
+
+		if i < v.Attempts {
+			time.Sleep(v.Delay)
+		}
+	}
+
+	return fmt.Errorf("error verifying %s: %w", name, err)
+}
+
+// pushVerified pushes the current passwords of the secret with push and, when the association has a
+// verify block, checks them with probe. If they do not authenticate and on_failure is rollback, the
+// previous passwords are pushed back and the previous secret version is made current again.
+func pushVerified(d *schema.ResourceData, session *session.Session, push func(Password) diag.Diagnostics, probe func(Verify, Password) error) diag.Diagnostics {
+	secretId := getSecretId(d)
+
+	p, versionId, err := getPasswordStage(secretId, "AWSCURRENT", session)
+
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	diags := push(p)
+
+	if diags.HasError() {
+		return diags
+	}
+
+	v, ok := getVerify(d)
+
+	if !ok {
+		return diags
+	}
+
+	verifyErr := probe(v, p)
+
+	if verifyErr == nil {
+		return diags
+	}
+
+	if v.OnFailure == VerifyOnFailureRollback {
+		previous, previousVersionId, err := getPasswordStage(secretId, "AWSPREVIOUS", session)
+
+		if isSecretNotFound(err) {
+			previousVersionId, err = "", nil
+		}
+
+		if err != nil {
+			return append(diags, diag.FromErr(err)...)
+		}
+
+		if previousVersionId == "" {
+			return append(diags, diag.Errorf("%s, and secret (%s) has no previous version to roll back to", verifyErr, secretId)...)
+		}
+
+		log.Printf("[WARN] rolling back secret (%s) to version %s", secretId, previousVersionId)
+
+		if rollbackDiags := push(previous); rollbackDiags.HasError() {
+			return append(append(diags, diag.Errorf("%s, and rolling back failed", verifyErr)...), rollbackDiags...)
+		}
+
+		if err := rollbackSecret(secretsmanager.New(session), secretId, versionId, previousVersionId); err != nil {
+			return append(diags, diag.Errorf("%s, and rolling back failed: %s", verifyErr, err)...)
+		}
+
+		return append(diags, diag.Errorf("%s, rolled back to the previous passwords", verifyErr)...)
+	}
+
+	return append(diags, diag.FromErr(verifyErr)...)
+}
+
+// rollbackSecret moves AWSCURRENT from the current version back to the previous one.
+func rollbackSecret(svc *secretsmanager.SecretsManager, secretId string, versionId string, previousVersionId string) error {
+	_, err := svc.UpdateSecretVersionStage(&secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:            aws.String(secretId),
+		VersionStage:        aws.String("AWSCURRENT"),
+		MoveToVersionId:     aws.String(previousVersionId),
+		RemoveFromVersionId: aws.String(versionId),
+	})
+
+	if err != nil {
+		return fmt.Errorf("error rolling back secret (%s): %w", secretId, err)
+	}
+
+	return nil
+}
+
+// verifyDatabase checks a Postgres or MySQL login.
+func verifyDatabase(engine string, host string, port int, username string, password string, database string, sslmode string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), verifyProbeTimeout)
+	defer cancel()
+
+	db, err := openDatabase(ctx, engine, host, port, username, password, database, sslmode)
+
+	if err != nil {
+		return err
+	}
+
+	return db.Close()
+}
+
+// verifyRedisAuth checks a Redis AUTH, as username unless it is empty.
+func verifyRedisAuth(host string, port int, useTls bool, username string, password string) error {
+	client, err := openRedis(host, port, useTls, username, password)
+
+	if err != nil {
+		return err
+	}
+
+	return client.Close()
+}
+
+// verifyHttpBasicAuth checks that an endpoint accepts the credential. Responses other than
+// 401, 403 and server errors count as authenticated.
+func verifyHttpBasicAuth(endpoint string, username string, password string) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(username, password)
+
+	resp, err := (&http.Client{Timeout: verifyProbeTimeout}).Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden || resp.StatusCode >= 500 {
+		return fmt.Errorf("%s returned %d for %s", endpoint, resp.StatusCode, username)
+	}
+
+	return nil
+}
+
+// verifyStomp checks a STOMP CONNECT, as offered by ActiveMQ brokers on stomp+ssl endpoints.
+func verifyStomp(address string, useTls bool, username string, password string) error {
+	dialer := &net.Dialer{Timeout: verifyProbeTimeout}
+
+	var conn net.Conn
+	var err error
+
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	if useTls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error connecting to STOMP endpoint (%s): %w", address, err)
+	}
+
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(verifyProbeTimeout)); err != nil {
+		return err
+	}
+
+	frame := fmt.Sprintf("CONNECT\naccept-version:1.0,1.1,1.2\nhost:%s\nlogin:%s\npasscode:%s\n\n\x00", host, username, password)
+
+	if _, err := conn.Write([]byte(frame)); err != nil {
+		return err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+
+	if err != nil {
+		return fmt.Errorf("error reading STOMP reply (%s): %w", address, err)
+	}
+
+	reply = strings.TrimLeft(reply, "\r\n")
+	command := strings.SplitN(reply, "\n", 2)[0]
+
+	if strings.TrimSpace(command) != "CONNECTED" {
+		return fmt.Errorf("STOMP endpoint (%s) rejected %s: %s", address, username, strings.TrimRight(reply, "\x00"))
+	}
+
+	conn.Write([]byte("DISCONNECT\n\n\x00"))
+
+	return nil
+}
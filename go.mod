@@ -3,8 +3,10 @@ module github.com/better/terraform-provider-better
 go 1.15
 
 require (
-	github.com/aws/aws-sdk-go v1.38.13
+	github.com/aws/aws-sdk-go v1.45.28
+	github.com/go-sql-driver/mysql v1.5.0
 	github.com/hashicorp/aws-sdk-go-base v0.7.0
 	github.com/hashicorp/terraform-plugin-sdk/v2 v2.3.0
+	github.com/lib/pq v1.10.9
 	github.com/strongdm/strongdm-sdk-go v0.9.21
 )
@@ -37,6 +37,9 @@ locals {
   mq_broker_name        = "tfp-test-mq"
   mq_username           = "test"
 
+  rabbitmq_engine_version = "3.8.11"
+  rabbitmq_broker_name    = "tfp-test-rabbitmq"
+
   # Cache
   cache_auth_token                    = "dummy_password_99999999999"
   cache_cluster_name                  = "tfp-test-redis"
@@ -46,6 +49,18 @@ locals {
   cache_subnet_group_name             = "ops-01-elasticache"
   cache_port                          = "6379"
   cache_security_group_ids            = ["sg-0df26abf9ad205709"]
+
+  # Standalone Redis cache cluster with an AUTH token, created outside of this configuration
+  cache_standalone_cluster_id = "tfp-test-redis-standalone"
+
+  # Redis global datastore spanning us-east-1 and us-west-2, created outside of this configuration
+  cache_global_replication_group_id = "ldgnf-tfp-test-redis-global"
+
+  # RDS Proxy
+  db_proxy_subnet_ids = ["subnet-0a1b2c3d4e5f60718", "subnet-0f1e2d3c4b5a69788"]
+
+  # MSK
+  msk_subnet_ids = ["subnet-0a1b2c3d4e5f60718", "subnet-0f1e2d3c4b5a69788"]
 }
 
 # Database
@@ -55,7 +70,9 @@ resource "aws_secretsmanager_secret" "db" {
 }
 
 resource "better_database_password" "db" {
-  secret_id = aws_secretsmanager_secret.db.id
+  secret_id  = aws_secretsmanager_secret.db.id
+  keys       = ["ADMIN_PASSWORD", "USER_PASSWORD", "READONLY_USER_PASSWORD"]
+  on_destroy = "clear_secret"
 }
 
 resource "aws_db_instance" "db" {
@@ -122,20 +139,136 @@ resource "sdm_resource" "db_ro" {
 resource "better_database_password_association" "better_admin" {
   secret_id = better_database_password.db.secret_id
   db_id     = aws_db_instance.db.id
-  db_users = [
-    {
-      key    = "ADMIN_PASSWORD",
-      sdm_id = sdm_resource.db_admin.id,
-    },
-    {
-      key    = "USER_PASSWORD",
-      sdm_id = sdm_resource.db_service.id
-    },
-    {
-      key    = "READONLY_USER_PASSWORD",
-      sdm_id = sdm_resource.db_ro.id
-    }
-  ]
+
+  db_users {
+    key     = "ADMIN_PASSWORD"
+    sdm_ids = [sdm_resource.db_admin.id]
+  }
+
+  db_users {
+    key     = "USER_PASSWORD"
+    sdm_ids = [sdm_resource.db_service.id]
+  }
+
+  db_users {
+    key      = "READONLY_USER_PASSWORD"
+    username = local.db_ro_username
+    sdm_ids  = [sdm_resource.db_ro.id]
+  }
+
+  wait_for_sdm_healthy = true
+  on_destroy           = "scramble"
+}
+
+resource "aws_secretsmanager_secret" "db_rds" {
+  name_prefix             = local.prefix
+  recovery_window_in_days = 0
+}
+
+resource "better_database_password" "db_rds" {
+  secret_id = aws_secretsmanager_secret.db_rds.id
+  format    = "rds"
+  username  = local.db_admin_username
+  db_id     = aws_db_instance.db.id
+}
+
+resource "sdm_secret_store" "aws" {
+  aws {
+    name   = "${local.prefix}secrets-manager"
+    region = "us-east-1"
+  }
+}
+
+resource "sdm_resource" "db_rds" {
+  postgres {
+    name = "${local.prefix}${local.db_admin_username}-rds"
+
+    hostname = aws_db_instance.db.address
+    port     = aws_db_instance.db.port
+
+    username = local.db_admin_username
+    password = local.password
+
+    database = local.db_engine
+  }
+
+  # Managed by better_database_password_association.db_rds
+  lifecycle {
+    ignore_changes = [postgres]
+  }
+}
+
+resource "better_database_password_association" "db_rds" {
+  secret_id = better_database_password.db_rds.secret_id
+  db_id     = aws_db_instance.db.id
+  format    = "rds"
+
+  db_users {
+    sdm_ids = [sdm_resource.db_rds.id]
+  }
+
+  # Points the sdm resource at the secret once, later rotations need no sdm writes
+  sdm_secret_store_id = sdm_secret_store.aws.id
+
+  verify {}
+
+  depends_on = [better_database_password_association.better_admin]
+}
+
+data "better_password" "db" {
+  secret_id = better_database_password.db.secret_id
+}
+
+output "db_password_keys" {
+  value = data.better_password.db.keys
+}
+
+output "db_admin_password" {
+  value     = data.better_password.db.values["ADMIN_PASSWORD"]
+  sensitive = true
+}
+
+data "better_sdm_credential_status" "db_admin" {
+  secret_id = better_database_password_association.better_admin.secret_id
+  key       = "ADMIN_PASSWORD"
+  sdm_id    = sdm_resource.db_admin.id
+}
+
+output "db_admin_sdm_in_sync" {
+  value = data.better_sdm_credential_status.db_admin.in_sync
+}
+
+# Self-hosted Postgres, started by `make postgres-server` trusting any password
+resource "aws_secretsmanager_secret" "db_self_hosted" {
+  name_prefix             = local.prefix
+  recovery_window_in_days = 0
+}
+
+resource "better_database_password" "db_self_hosted" {
+  secret_id  = aws_secretsmanager_secret.db_self_hosted.id
+  keys       = ["ADMIN_PASSWORD"]
+  on_destroy = "clear_secret"
+}
+
+resource "better_database_password_association" "db_self_hosted" {
+  secret_id = better_database_password.db_self_hosted.secret_id
+
+  target {
+    host           = "host.docker.internal"
+    sslmode        = "disable"
+    admin_username = "postgres"
+  }
+
+  db_users {
+    key      = "ADMIN_PASSWORD"
+    username = "postgres"
+  }
+
+  verify {
+    attempts   = 3
+    delay      = 5
+    on_failure = "rollback"
+  }
 }
 
 # MQ
@@ -184,27 +317,98 @@ resource "sdm_resource" "mq" {
 }
 
 resource "better_mq_password" "mq" {
-  secret_id = aws_secretsmanager_secret.mq.id
+  secret_id  = aws_secretsmanager_secret.mq.id
+  on_destroy = "retain"
 }
 
 resource "better_mq_password_association" "mq_admin" {
   secret_id = better_mq_password.mq.secret_id
 
-  mq_id  = aws_mq_broker.mq.id
-  sdm_id = sdm_resource.mq.id
-
-  mq_users = [
-    {
-      user           = "admin"
-      key            = "ADMIN_PASSWORD"
-      console_access = true
-    },
-    {
-      user           = local.mq_username
-      key            = "USER_PASSWORD"
-      console_access = false
-    }
-  ]
+  mq_id = aws_mq_broker.mq.id
+
+  reboot_policy        = "immediate"
+  delete_removed_users = true
+
+  mq_users {
+    username       = "admin"
+    key            = "ADMIN_PASSWORD"
+    console_access = true
+    sdm_ids        = [sdm_resource.mq.id]
+  }
+
+  mq_users {
+    username       = local.mq_username
+    key            = "USER_PASSWORD"
+    console_access = false
+    groups         = ["producers", "consumers"]
+  }
+
+  on_destroy = "remove_sdm_credentials"
+}
+
+resource "aws_secretsmanager_secret" "rabbitmq" {
+  name_prefix             = local.prefix
+  recovery_window_in_days = 0
+}
+
+resource "aws_mq_broker" "rabbitmq" {
+  broker_name = local.rabbitmq_broker_name
+
+  engine_type    = "RabbitMQ"
+  engine_version = local.rabbitmq_engine_version
+
+  host_instance_type  = local.mq_host_instance_type
+  publicly_accessible = true
+
+  user {
+    username = "admin"
+    password = local.password
+  }
+}
+
+resource "better_mq_password" "rabbitmq" {
+  secret_id = aws_secretsmanager_secret.rabbitmq.id
+}
+
+resource "better_mq_password_association" "rabbitmq" {
+  secret_id = better_mq_password.rabbitmq.secret_id
+
+  mq_id = aws_mq_broker.rabbitmq.id
+
+  # The broker is created with local.password, before the secret is first pushed to it
+  bootstrap_password = local.password
+
+  mq_users {
+    username = "admin"
+    key      = "ADMIN_PASSWORD"
+  }
+}
+
+# Local RabbitMQ management API, started by `make rabbitmq-server` with admin/bootstrap
+resource "aws_secretsmanager_secret" "rabbitmq_local" {
+  name_prefix             = local.prefix
+  recovery_window_in_days = 0
+}
+
+resource "better_mq_password" "rabbitmq_local" {
+  secret_id = aws_secretsmanager_secret.rabbitmq_local.id
+}
+
+resource "better_mq_password_association" "rabbitmq_local" {
+  secret_id = better_mq_password.rabbitmq_local.secret_id
+
+  management_url     = "http://host.docker.internal:15672"
+  bootstrap_password = "bootstrap"
+
+  mq_users {
+    username = "admin"
+    key      = "ADMIN_PASSWORD"
+  }
+
+  verify {
+    attempts = 3
+    delay    = 1
+  }
 }
 
 # ElastiCache
@@ -237,11 +441,482 @@ resource "sdm_resource" "cache" {
 }
 
 resource "better_cache_password" "cache" {
-  secret_id = aws_secretsmanager_secret.cache.id
+  secret_id  = aws_secretsmanager_secret.cache.id
+  on_destroy = "clear_secret"
 }
 
 resource "better_cache_password_association" "cache" {
   secret_id            = better_cache_password.cache.secret_id
   replication_group_id = aws_elasticache_replication_group.cache.id
   sdm_id               = sdm_resource.cache.id
+  on_destroy           = "scramble"
+
+  verify {}
+}
+
+resource "aws_secretsmanager_secret" "cache_standalone" {
+  name_prefix             = local.prefix
+  recovery_window_in_days = 0
+}
+
+resource "better_cache_password" "cache_standalone" {
+  secret_id  = aws_secretsmanager_secret.cache_standalone.id
+  on_destroy = "clear_secret"
+}
+
+data "aws_elasticache_cluster" "cache_standalone" {
+  cluster_id = local.cache_standalone_cluster_id
+}
+
+resource "better_cache_password_association" "cache_standalone" {
+  secret_id        = better_cache_password.cache_standalone.secret_id
+  cache_cluster_id = local.cache_standalone_cluster_id
+  on_destroy       = "scramble"
+
+  # Created with the current auth token, deleted on destroy
+  sdm_resource {
+    name     = "${local.prefix}redis-standalone"
+    hostname = data.aws_elasticache_cluster.cache_standalone.cache_nodes[0].address
+    port     = data.aws_elasticache_cluster.cache_standalone.port
+
+    tags = {
+      managed_by = "better"
+    }
+  }
+
+  wait_for_sdm_healthy = true
+}
+
+output "cache_standalone_sdm_id" {
+  value = better_cache_password_association.cache_standalone.sdm_resource_id
+}
+
+resource "aws_secretsmanager_secret" "cache_global" {
+  name_prefix             = local.prefix
+  recovery_window_in_days = 0
+}
+
+resource "better_cache_password" "cache_global" {
+  secret_id  = aws_secretsmanager_secret.cache_global.id
+  on_destroy = "clear_secret"
+}
+
+resource "better_cache_password_association" "cache_global" {
+  secret_id                   = better_cache_password.cache_global.secret_id
+  global_replication_group_id = local.cache_global_replication_group_id
+  on_destroy                  = "scramble"
+}
+
+# Self-hosted Redis, started by `make redis-server` with the password bootstrap
+resource "aws_secretsmanager_secret" "redis" {
+  name_prefix             = local.prefix
+  recovery_window_in_days = 0
+}
+
+resource "better_cache_password" "redis" {
+  secret_id  = aws_secretsmanager_secret.redis.id
+  on_destroy = "clear_secret"
+}
+
+resource "better_redis_password_association" "redis" {
+  secret_id = better_cache_password.redis.secret_id
+  host      = "host.docker.internal"
+  admin_key = "AUTH_TOKEN"
+
+  bootstrap_password = "bootstrap"
+
+  redis_users {
+    key = "AUTH_TOKEN"
+  }
+
+  persist = false
+
+  verify {
+    attempts = 3
+    delay    = 1
+  }
+}
+
+# MemoryDB
+resource "aws_secretsmanager_secret" "memorydb" {
+  name_prefix             = local.prefix
+  recovery_window_in_days = 0
+}
+
+resource "better_cache_password" "memorydb" {
+  secret_id  = aws_secretsmanager_secret.memorydb.id
+  keys       = ["USER_PASSWORD"]
+  on_destroy = "clear_secret"
+}
+
+resource "aws_memorydb_user" "memorydb" {
+  user_name     = "${local.prefix}${local.db_service_username}"
+  access_string = "on ~* &* +@all"
+
+  authentication_mode {
+    type      = "password"
+    passwords = [local.cache_auth_token]
+  }
+
+  lifecycle {
+    ignore_changes = [authentication_mode]
+  }
+}
+
+resource "aws_memorydb_acl" "memorydb" {
+  name       = "${local.prefix}memorydb"
+  user_names = [aws_memorydb_user.memorydb.user_name]
+}
+
+resource "aws_memorydb_cluster" "memorydb" {
+  name                   = "tfp-test-memorydb"
+  acl_name               = aws_memorydb_acl.memorydb.name
+  node_type              = "db.t4g.small"
+  num_shards             = 1
+  num_replicas_per_shard = 0
+  security_group_ids     = local.cache_security_group_ids
+}
+
+resource "sdm_resource" "memorydb" {
+  elasticache_redis {
+    name         = "${local.prefix}memorydb"
+    hostname     = aws_memorydb_cluster.memorydb.cluster_endpoint[0].address
+    password     = local.cache_auth_token
+    port         = local.cache_port
+    tls_required = true
+  }
+}
+
+resource "better_memorydb_password_association" "memorydb" {
+  secret_id = better_cache_password.memorydb.secret_id
+
+  memorydb_users {
+    key      = "USER_PASSWORD"
+    username = aws_memorydb_user.memorydb.user_name
+    sdm_ids  = [sdm_resource.memorydb.id]
+  }
+
+  verify {}
+
+  on_destroy = "scramble"
+}
+
+# DocumentDB
+resource "aws_secretsmanager_secret" "docdb" {
+  name_prefix             = local.prefix
+  recovery_window_in_days = 0
+}
+
+resource "better_database_password" "docdb" {
+  secret_id = aws_secretsmanager_secret.docdb.id
+  keys      = ["ADMIN_PASSWORD"]
+}
+
+resource "aws_docdb_cluster" "docdb" {
+  cluster_identifier_prefix = local.prefix
+
+  master_username     = local.db_admin_username
+  master_password     = local.password
+  skip_final_snapshot = true
+  apply_immediately   = true
+
+  lifecycle {
+    ignore_changes = [master_password]
+  }
+}
+
+resource "aws_docdb_cluster_instance" "docdb" {
+  cluster_identifier = aws_docdb_cluster.docdb.id
+  instance_class     = "db.t3.medium"
+}
+
+resource "sdm_resource" "docdb" {
+  mongo_replica_set {
+    name = "${local.prefix}docdb"
+
+    hostname      = aws_docdb_cluster.docdb.endpoint
+    port          = aws_docdb_cluster.docdb.port
+    auth_database = "admin"
+    replica_set   = "rs0"
+    tls_required  = true
+
+    username = local.db_admin_username
+    password = local.password
+  }
+}
+
+resource "better_docdb_password_association" "docdb" {
+  secret_id  = better_database_password.docdb.secret_id
+  cluster_id = aws_docdb_cluster.docdb.id
+
+  db_users {
+    key     = "ADMIN_PASSWORD"
+    sdm_ids = [sdm_resource.docdb.id]
+  }
+
+  depends_on = [aws_docdb_cluster_instance.docdb]
+}
+
+# Redshift
+resource "aws_secretsmanager_secret" "redshift" {
+  name_prefix             = local.prefix
+  recovery_window_in_days = 0
+}
+
+resource "better_database_password" "redshift" {
+  secret_id = aws_secretsmanager_secret.redshift.id
+  keys      = ["ADMIN_PASSWORD", "USER_PASSWORD"]
+}
+
+resource "aws_redshift_cluster" "redshift" {
+  cluster_identifier  = "${local.prefix}redshift"
+  database_name       = "analytics"
+  master_username     = local.db_admin_username
+  master_password     = "Fake1fake1fake1"
+  node_type           = "dc2.large"
+  cluster_type        = "single-node"
+  skip_final_snapshot = true
+
+  lifecycle {
+    ignore_changes = [master_password]
+  }
+}
+
+resource "sdm_resource" "redshift" {
+  redshift {
+    name = "${local.prefix}redshift"
+
+    hostname = aws_redshift_cluster.redshift.dns_name
+    port     = aws_redshift_cluster.redshift.port
+    database = aws_redshift_cluster.redshift.database_name
+
+    username = local.db_admin_username
+    password = "Fake1fake1fake1"
+  }
+}
+
+resource "better_redshift_password_association" "redshift" {
+  secret_id   = better_database_password.redshift.secret_id
+  cluster_id  = aws_redshift_cluster.redshift.id
+  alter_users = true
+
+  db_users {
+    key     = "ADMIN_PASSWORD"
+    sdm_ids = [sdm_resource.redshift.id]
+  }
+
+  db_users {
+    key      = "USER_PASSWORD"
+    username = local.db_service_username
+  }
+
+  verify {}
+}
+
+# OpenSearch
+resource "aws_secretsmanager_secret" "opensearch" {
+  name_prefix             = local.prefix
+  recovery_window_in_days = 0
+}
+
+resource "better_database_password" "opensearch" {
+  secret_id           = aws_secretsmanager_secret.opensearch.id
+  keys                = ["ADMIN_PASSWORD"]
+  include_punctuation = true
+}
+
+resource "aws_opensearch_domain" "opensearch" {
+  domain_name    = "tfp-test-opensearch"
+  engine_version = "OpenSearch_2.5"
+
+  cluster_config {
+    instance_type = "t3.small.search"
+  }
+
+  ebs_options {
+    ebs_enabled = true
+    volume_size = 10
+  }
+
+  encrypt_at_rest {
+    enabled = true
+  }
+
+  node_to_node_encryption {
+    enabled = true
+  }
+
+  domain_endpoint_options {
+    enforce_https = true
+  }
+
+  advanced_security_options {
+    enabled                        = true
+    internal_user_database_enabled = true
+
+    master_user_options {
+      master_user_name     = local.db_admin_username
+      master_user_password = "Fake1fake1fake1!"
+    }
+  }
+
+  lifecycle {
+    ignore_changes = [advanced_security_options]
+  }
+}
+
+resource "sdm_resource" "opensearch" {
+  http_basic_auth {
+    name = "${local.prefix}opensearch"
+
+    url = "https://${aws_opensearch_domain.opensearch.endpoint}"
+
+    username = local.db_admin_username
+    password = "Fake1fake1fake1!"
+
+    healthcheck_path = "/"
+    subdomain        = "opensearch-${local.prefix}test"
+  }
+}
+
+resource "better_opensearch_password_association" "opensearch" {
+  secret_id   = better_database_password.opensearch.secret_id
+  domain_name = aws_opensearch_domain.opensearch.domain_name
+  master_user = local.db_admin_username
+  sdm_ids     = [sdm_resource.opensearch.id]
+
+  verify {
+    on_failure = "rollback"
+  }
+}
+
+# RDS Proxy
+resource "aws_secretsmanager_secret" "db_proxy_admin" {
+  name_prefix             = "${local.prefix}proxy-"
+  recovery_window_in_days = 0
+}
+
+resource "aws_secretsmanager_secret" "db_proxy_service" {
+  name_prefix             = "${local.prefix}proxy-"
+  recovery_window_in_days = 0
+}
+
+resource "aws_iam_role" "db_proxy" {
+  name_prefix = local.prefix
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect    = "Allow"
+      Action    = "sts:AssumeRole"
+      Principal = { Service = "rds.amazonaws.com" }
+    }]
+  })
+}
+
+resource "aws_iam_role_policy" "db_proxy" {
+  role = aws_iam_role.db_proxy.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect = "Allow"
+      Action = "secretsmanager:GetSecretValue"
+      Resource = [
+        aws_secretsmanager_secret.db_proxy_admin.arn,
+        aws_secretsmanager_secret.db_proxy_service.arn,
+      ]
+    }]
+  })
+}
+
+resource "aws_db_proxy" "db" {
+  name           = "tfp-test-proxy"
+  engine_family  = "POSTGRESQL"
+  role_arn       = aws_iam_role.db_proxy.arn
+  vpc_subnet_ids = local.db_proxy_subnet_ids
+
+  auth {
+    auth_scheme = "SECRETS"
+    iam_auth    = "DISABLED"
+    secret_arn  = aws_secretsmanager_secret.db_proxy_admin.arn
+  }
+
+  lifecycle {
+    ignore_changes = [auth]
+  }
+}
+
+resource "aws_db_proxy_default_target_group" "db" {
+  db_proxy_name = aws_db_proxy.db.name
+}
+
+resource "aws_db_proxy_target" "db" {
+  db_proxy_name          = aws_db_proxy.db.name
+  target_group_name      = aws_db_proxy_default_target_group.db.name
+  db_instance_identifier = aws_db_instance.db.id
+}
+
+resource "better_rds_proxy_auth_association" "db" {
+  secret_id  = better_database_password_association.better_admin.secret_id
+  proxy_name = aws_db_proxy_target.db.db_proxy_name
+
+  proxy_users {
+    key       = "ADMIN_PASSWORD"
+    username  = local.db_admin_username
+    secret_id = aws_secretsmanager_secret.db_proxy_admin.id
+  }
+
+  proxy_users {
+    key       = "USER_PASSWORD"
+    username  = local.db_service_username
+    secret_id = aws_secretsmanager_secret.db_proxy_service.id
+  }
+
+  verify {}
+
+  on_destroy = "clear_secret"
+}
+
+# MSK
+resource "aws_kms_key" "msk" {
+  description             = "${local.prefix}msk-scram"
+  deletion_window_in_days = 7
+}
+
+resource "aws_secretsmanager_secret" "msk" {
+  name_prefix             = "AmazonMSK_${local.prefix}"
+  kms_key_id              = aws_kms_key.msk.key_id
+  recovery_window_in_days = 0
+}
+
+resource "aws_msk_cluster" "msk" {
+  cluster_name           = "tfp-test-msk"
+  kafka_version          = "2.8.1"
+  number_of_broker_nodes = 2
+
+  broker_node_group_info {
+    instance_type   = "kafka.t3.small"
+    client_subnets  = local.msk_subnet_ids
+    security_groups = local.cache_security_group_ids
+
+    storage_info {
+      ebs_storage_info {
+        volume_size = 10
+      }
+    }
+  }
+
+  client_authentication {
+    sasl {
+      scram = true
+    }
+  }
+}
+
+resource "better_msk_scram_password" "msk" {
+  secret_id   = aws_secretsmanager_secret.msk.id
+  username    = local.mq_username
+  cluster_arn = aws_msk_cluster.msk.arn
+  on_destroy  = "clear_secret"
 }